@@ -4,11 +4,14 @@ go 1.22.0
 
 require (
 	github.com/apple/pkl-go v0.6.0
+	github.com/fxamacker/cbor/v2 v2.9.2
 	github.com/marcinbor85/gohex v0.0.0-20210308104911-55fb1c624d84
 	google.golang.org/protobuf v1.33.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/vmihailenco/msgpack/v5 v5.4.1 // indirect
 	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 )
@@ -1,15 +1,20 @@
 package nrf
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
+	"crypto/hmac"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/pem"
 	"errors"
-	"fmt"
 	"math/big"
 	"strings"
 )
@@ -19,6 +24,84 @@ func sha256Sum(b []byte) []byte {
 	return h[:]
 }
 
+// hkdfSha256 implements HKDF (RFC 5869) with SHA256.
+func hkdfSha256(secret, salt, info []byte, size int) []byte {
+	if salt == nil {
+		salt = make([]byte, sha256.Size)
+	}
+	ext := hmac.New(sha256.New, salt)
+	ext.Write(secret)
+	prk := ext.Sum(nil)
+	var out, t []byte
+	for i := byte(1); len(out) < size; i++ {
+		exp := hmac.New(sha256.New, prk)
+		exp.Write(t)
+		exp.Write(info)
+		exp.Write([]byte{i})
+		t = exp.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:size]
+}
+
+var aesKWIV = []byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6}
+
+// aesKeyWrap implements AES key wrap (RFC 3394).
+func aesKeyWrap(kek, b []byte) ([]byte, error) {
+	if len(b) < 16 || len(b)%8 != 0 {
+		return nil, errors.New("invalid key size")
+	}
+	c, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(b) / 8
+	a := bytes.Clone(aesKWIV)
+	r := bytes.Clone(b)
+	buf := make([]byte, aes.BlockSize)
+	for j := 0; j <= 5; j++ {
+		for i := 1; i <= n; i++ {
+			copy(buf, a)
+			copy(buf[8:], r[(i-1)*8:i*8])
+			c.Encrypt(buf, buf)
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buf[:8])^t)
+			copy(r[(i-1)*8:], buf[8:])
+		}
+	}
+	return append(a, r...), nil
+}
+
+// aesKeyUnwrap implements AES key unwrap (RFC 3394).
+func aesKeyUnwrap(kek, b []byte) ([]byte, error) {
+	if len(b) < 24 || len(b)%8 != 0 {
+		return nil, errors.New("invalid wrapped key size")
+	}
+	c, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(b)/8 - 1
+	a := bytes.Clone(b[:8])
+	r := bytes.Clone(b[8:])
+	buf := make([]byte, aes.BlockSize)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			copy(buf, a)
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(buf[:8], binary.BigEndian.Uint64(buf[:8])^t)
+			copy(buf[8:], r[(i-1)*8:i*8])
+			c.Decrypt(buf, buf)
+			copy(a, buf[:8])
+			copy(r[(i-1)*8:], buf[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(a, aesKWIV) == 0 {
+		return nil, errors.New("aes key unwrap: integrity check failed")
+	}
+	return r, nil
+}
+
 func setP256PublicKey(key []byte) (*ecdsa.PublicKey, error) {
 	size := len(key)
 	if size == 0x41 && key[0] == 0x04 {
@@ -36,40 +119,23 @@ func setP256PublicKey(key []byte) (*ecdsa.PublicKey, error) {
 	return pk, nil
 }
 
-func verifySignatureP256(key *ecdsa.PublicKey, msg, sig []byte) bool {
-	h := sha256Sum(msg)
-	r := big.NewInt(0).SetBytes(sig[:0x20])
-	s := big.NewInt(0).SetBytes(sig[0x20:])
-	return ecdsa.Verify(key, h, r, s)
-}
-
-func verifySignatureEd25519(key ed25519.PublicKey, msg, sig []byte) bool {
-	return ed25519.Verify(key, msg, sig)
+// verifySignatureP256Digest verifies a raw r||s signature over a digest.
+func verifySignatureP256Digest(key *ecdsa.PublicKey, h, sig []byte) bool {
+	return VerifyWith(ECDSAP256SHA256, key, crypto.SHA256, h, sig) == nil
 }
 
-// VerifySignature verifies firmware signatures using ECDSA P-256 or Ed25519 public keys.
-// pem format is also supported.
+// VerifySignature verifies a firmware signature with a PEM, DER or raw
+// public key using the default algorithm of the key, see KeyAlgorithm.
 func VerifySignature(vk, cmd, sig []byte) error {
-	if len(sig) != 0x40 {
-		return errors.New("invalid signature size")
+	key, err := parsePublicKey(vk)
+	if err != nil {
+		return err
 	}
-	if strings.Contains(string(vk), "PUBLIC KEY") {
-		key, err := loadKeyFromPem(vk)
-		if err != nil {
-			return err
-		}
-		var ok bool
-		switch key.(type) {
-		case *ecdsa.PublicKey:
-			pk := key.(*ecdsa.PublicKey)
-			ok = verifySignatureP256(pk, cmd, sig)
-		case ed25519.PublicKey:
-			pk := key.(ed25519.PublicKey)
-			ok = verifySignatureEd25519(pk, cmd, sig)
-		}
-		return validSignature(ok)
+	alg, err := KeyAlgorithm(key)
+	if err != nil {
+		return err
 	}
-	return verifySignature(vk, cmd, sig)
+	return VerifyWith(alg, key, 0, cmd, sig)
 }
 
 func validSignature(ok bool) error {
@@ -79,33 +145,29 @@ func validSignature(ok bool) error {
 	return errors.New("failed to firmware verification")
 }
 
-func verifySignature(key, msg, sig []byte) error {
-	var ok bool
-	switch len(key) {
-	case 0x20:
-		pk := ed25519.PublicKey(key)
-		ok = verifySignatureEd25519(pk, msg, sig)
-	case 0x40, 0x41:
-		pk, err := setP256PublicKey(key)
-		if err != nil {
-			return err
+// parsePublicKey accepts PEM, DER SubjectPublicKeyInfo, PKCS#1 RSA keys and
+// raw Ed25519 or P-256 keys.
+func parsePublicKey(b []byte) (any, error) {
+	if strings.Contains(string(b), "PUBLIC KEY") {
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, errors.New("invalid pem block")
 		}
-		ok = verifySignatureP256(pk, msg, sig)
-		fmt.Println(ok)
+		b = block.Bytes
 	}
-	return validSignature(ok)
-}
-
-func loadKeyFromPem(b []byte) (any, error) {
-	block, _ := pem.Decode(b)
-	if block == nil || block.Type != "PUBLIC KEY" {
-		return nil, errors.New("invalid block or block type")
+	if key, err := x509.ParsePKIXPublicKey(b); err == nil {
+		return key, nil
 	}
-	key, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return nil, err
+	if key, err := loadRsaKey(b); err == nil {
+		return key, nil
 	}
-	return key, nil
+	switch len(b) {
+	case 0x20:
+		return ed25519.PublicKey(b), nil
+	case 0x40, 0x41:
+		return setP256PublicKey(b)
+	}
+	return nil, errors.New("unsupported public key format")
 }
 
 func loadRsaKey(b []byte) (*rsa.PublicKey, error) {
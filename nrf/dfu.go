@@ -139,6 +139,7 @@ func unmarshalPacket(b []byte) (*dfu.Packet, error) {
 type DfuInfo struct {
 	appHash []byte
 	sig     []byte
+	sigType dfu.SignatureType
 	cmd     []byte
 }
 
@@ -163,12 +164,18 @@ func parsePacket(packet *dfu.Packet) (*DfuInfo, error) {
 	}
 	slices.Reverse(hash.Hash)
 	sig := sc.Signature
-	//　Public keys are used in little-endian and need to be converted back to big-endian.
-	slices.Reverse(sig[:0x20])
-	slices.Reverse(sig[0x20:])
+	sigType := sc.GetSignatureType()
+	if sigType == dfu.SignatureType_ECDSA_P256_SHA256 {
+		if len(sig) != 0x40 {
+			return nil, errors.New("invalid signature size")
+		}
+		//　Public keys are used in little-endian and need to be converted back to big-endian.
+		slices.Reverse(sig[:0x20])
+		slices.Reverse(sig[0x20:])
+	}
 
 	return &DfuInfo{
-		sig: sig, appHash: hash.Hash, cmd: v}, nil
+		sig: sig, sigType: sigType, appHash: hash.Hash, cmd: v}, nil
 }
 
 func (d *DfuInfo) String() string {
@@ -181,7 +188,26 @@ func (d *DfuInfo) Signature() []byte {
 	return d.sig
 }
 
+// SignatureAlgorithm returns the algorithm of the init packet signature.
+func (d *DfuInfo) SignatureAlgorithm() (SignatureAlgorithm, error) {
+	switch d.sigType {
+	case dfu.SignatureType_ECDSA_P256_SHA256:
+		return ECDSAP256SHA256, nil
+	case dfu.SignatureType_ED25519:
+		return Ed25519, nil
+	}
+	return 0, fmt.Errorf("unsupported signature type %v", d.sigType)
+}
+
 // Verify verifies the signature of OTA dfu files
 func (d *DfuInfo) Verify(key []byte) error {
-	return VerifySignature(key, d.cmd, d.sig)
+	pk, err := parsePublicKey(key)
+	if err != nil {
+		return err
+	}
+	alg, err := d.SignatureAlgorithm()
+	if err != nil {
+		return err
+	}
+	return VerifyWith(alg, pk, 0, d.cmd, d.sig)
 }
@@ -0,0 +1,106 @@
+package nrf
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"io"
+	"sort"
+)
+
+var elfMagic = []byte{0x7f, 'E', 'L', 'F'}
+
+// ElfImage is the flash image described by the loadable segments of an ELF
+// file such as zephyr.elf or an nRF5 SDK .out file.
+type ElfImage struct {
+	image   *FlashImage
+	symbols []elf.Symbol
+}
+
+func isElfFile(b []byte) bool {
+	return bytes.HasPrefix(b, elfMagic)
+}
+
+// ElfFileToBinary returns the flash image of an ELF file starting at address 0.
+func ElfFileToBinary(b []byte) ([]byte, error) {
+	img, err := ReadElf(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	return img.Binary(), nil
+}
+
+// ReadElf loads the PT_LOAD segments at their physical addresses and keeps
+// the symbol table.
+func ReadElf(r io.ReaderAt) (*ElfImage, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img := NewFlashImage()
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || prog.Filesz == 0 {
+			continue
+		}
+		b := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(b, 0); err != nil {
+			return nil, err
+		}
+		if err := img.AddBinary(uint32(prog.Paddr), b); err != nil {
+			return nil, err
+		}
+	}
+	if img.Size() == 0 {
+		return nil, errors.New("elf: no loadable segments")
+	}
+	symbols, err := f.Symbols()
+	if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+		return nil, err
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return symbols[i].Value < symbols[j].Value
+	})
+	return &ElfImage{image: img, symbols: symbols}, nil
+}
+
+// Image returns the flash image built from the loadable segments.
+func (e *ElfImage) Image() *FlashImage {
+	return e.image
+}
+
+// Binary returns the flash image starting at address 0, padded with 0xFF.
+func (e *ElfImage) Binary() []byte {
+	return e.image.Binary()
+}
+
+// Symbols returns the symbol table sorted by address.
+func (e *ElfImage) Symbols() []elf.Symbol {
+	return e.symbols
+}
+
+// Lookup returns the symbol whose range contains addr.
+func (e *ElfImage) Lookup(addr uint32) (elf.Symbol, bool) {
+	return lookupSymbol(e.symbols, addr)
+}
+
+func lookupSymbol(symbols []elf.Symbol, addr uint32) (elf.Symbol, bool) {
+	for i := len(symbols) - 1; i >= 0; i-- {
+		sym := symbols[i]
+		if sym.Name == "" || sym.Section == elf.SHN_UNDEF {
+			continue
+		}
+		start := sym.Value
+		if elf.ST_TYPE(sym.Info) == elf.STT_FUNC {
+			// Thumb function addresses have the lowest bit set.
+			start &^= 1
+		}
+		if uint64(addr) < start {
+			continue
+		}
+		if uint64(addr) < start+sym.Size || (sym.Size == 0 && uint64(addr) == start) {
+			return sym, true
+		}
+	}
+	return elf.Symbol{}, false
+}
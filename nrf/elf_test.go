@@ -0,0 +1,182 @@
+package nrf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+)
+
+type testSegment struct {
+	vaddr, paddr uint32
+	data         []byte
+}
+
+type testSymbol struct {
+	name        string
+	value, size uint32
+	typ         elf.SymType
+}
+
+// buildTestElf writes a little-endian ARM ELF32 file with one PT_LOAD
+// segment and one section per segment. Symbols are placed in the first
+// section.
+func buildTestElf(t *testing.T, segs []testSegment, syms []testSymbol) []byte {
+	t.Helper()
+	const (
+		ehSize = 52
+		phSize = 32
+		shSize = 40
+	)
+	strtab := []byte{0}
+	symtab := new(bytes.Buffer)
+	binary.Write(symtab, binary.LittleEndian, elf.Sym32{})
+	for _, s := range syms {
+		binary.Write(symtab, binary.LittleEndian, elf.Sym32{
+			Name:  uint32(len(strtab)),
+			Value: s.value,
+			Size:  s.size,
+			Info:  elf.ST_INFO(elf.STB_GLOBAL, s.typ),
+			Shndx: 1,
+		})
+		strtab = append(append(strtab, s.name...), 0)
+	}
+	shstrtab := []byte{0}
+	shName := func(name string) uint32 {
+		off := uint32(len(shstrtab))
+		shstrtab = append(append(shstrtab, name...), 0)
+		return off
+	}
+
+	off := uint32(ehSize + phSize*len(segs))
+	var body bytes.Buffer
+	var progs []elf.Prog32
+	sections := []elf.Section32{{}}
+	for _, seg := range segs {
+		progs = append(progs, elf.Prog32{
+			Type:   uint32(elf.PT_LOAD),
+			Off:    off,
+			Vaddr:  seg.vaddr,
+			Paddr:  seg.paddr,
+			Filesz: uint32(len(seg.data)),
+			Memsz:  uint32(len(seg.data)),
+			Flags:  uint32(elf.PF_R | elf.PF_X),
+			Align:  4,
+		})
+		sections = append(sections, elf.Section32{
+			Name:      shName(".text"),
+			Type:      uint32(elf.SHT_PROGBITS),
+			Flags:     uint32(elf.SHF_ALLOC | elf.SHF_EXECINSTR),
+			Addr:      seg.vaddr,
+			Off:       off,
+			Size:      uint32(len(seg.data)),
+			Addralign: 4,
+		})
+		body.Write(seg.data)
+		off += uint32(len(seg.data))
+	}
+	symtabIdx := len(sections)
+	sections = append(sections, elf.Section32{
+		Name:      shName(".symtab"),
+		Type:      uint32(elf.SHT_SYMTAB),
+		Off:       off,
+		Size:      uint32(symtab.Len()),
+		Link:      uint32(symtabIdx + 1),
+		Info:      1,
+		Addralign: 4,
+		Entsize:   16,
+	})
+	body.Write(symtab.Bytes())
+	off += uint32(symtab.Len())
+	sections = append(sections, elf.Section32{
+		Name:      shName(".strtab"),
+		Type:      uint32(elf.SHT_STRTAB),
+		Off:       off,
+		Size:      uint32(len(strtab)),
+		Addralign: 1,
+	})
+	body.Write(strtab)
+	off += uint32(len(strtab))
+	shstrndx := len(sections)
+	sections = append(sections, elf.Section32{
+		Name:      shName(".shstrtab"),
+		Type:      uint32(elf.SHT_STRTAB),
+		Off:       off,
+		Addralign: 1,
+	})
+	sections[shstrndx].Size = uint32(len(shstrtab))
+	body.Write(shstrtab)
+	off += uint32(len(shstrtab))
+
+	var ident [elf.EI_NIDENT]byte
+	copy(ident[:], elfMagic)
+	ident[elf.EI_CLASS] = byte(elf.ELFCLASS32)
+	ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	var out bytes.Buffer
+	binary.Write(&out, binary.LittleEndian, elf.Header32{
+		Ident:     ident,
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_ARM),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     ehSize,
+		Shoff:     off,
+		Ehsize:    ehSize,
+		Phentsize: phSize,
+		Phnum:     uint16(len(progs)),
+		Shentsize: shSize,
+		Shnum:     uint16(len(sections)),
+		Shstrndx:  uint16(shstrndx),
+	})
+	binary.Write(&out, binary.LittleEndian, progs)
+	out.Write(body.Bytes())
+	binary.Write(&out, binary.LittleEndian, sections)
+	return out.Bytes()
+}
+
+func TestReadElf(t *testing.T) {
+	text := bytes.Repeat([]byte{0x10, 0xb5}, 0x20)
+	data := []byte{0xde, 0xad, 0xbe, 0xef}
+	b := buildTestElf(t, []testSegment{
+		{vaddr: 0x1000, paddr: 0x1000, data: text},
+		// .data is copied from flash to RAM: loaded at its physical address.
+		{vaddr: 0x20000000, paddr: 0x1040, data: data},
+	}, []testSymbol{
+		{"main", 0x1011, 0x10, elf.STT_FUNC},
+		{"config", 0x20000000, 4, elf.STT_OBJECT},
+	})
+
+	img, err := ReadElf(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := img.Binary()
+	if len(bin) != 0x1044 {
+		t.Fatalf("binary size = %#x, want 0x1044", len(bin))
+	}
+	if !bytes.Equal(bin[:0x1000], bytes.Repeat([]byte{0xff}, 0x1000)) {
+		t.Error("gap before the first segment is not erased")
+	}
+	if !bytes.Equal(bin[0x1000:0x1040], text) || !bytes.Equal(bin[0x1040:], data) {
+		t.Error("segments are not at their physical addresses")
+	}
+
+	// Thumb function addresses have the lowest bit set.
+	if sym, ok := img.Lookup(0x1010); !ok || sym.Name != "main" {
+		t.Errorf("Lookup(0x1010) = %q, %v", sym.Name, ok)
+	}
+	if _, ok := img.Lookup(0x1020); ok {
+		t.Error("Lookup(0x1020) found a symbol past the end of main")
+	}
+
+	conv, symbols, err := readImage(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(conv, bin) || len(symbols) != 2 {
+		t.Errorf("readImage returned %d bytes and %d symbols", len(conv), len(symbols))
+	}
+	if _, err := HexFileToBinary(b); err != nil {
+		t.Errorf("HexFileToBinary(elf): %v", err)
+	}
+}
@@ -2,11 +2,11 @@ package nrf
 
 import (
 	"bytes"
+	"debug/elf"
 	"encoding/binary"
 	"errors"
 	"hash/crc32"
 	"io"
-	"os"
 
 	"github.com/q0jt/go-nrf/nrf/config"
 	"github.com/q0jt/go-nrf/nrf/config/arch"
@@ -15,18 +15,43 @@ import (
 var invalidCrc = errors.New("mismatch　crc32")
 
 type Firmware struct {
-	r    io.ReaderAt
-	Attr *DfuSettingAttrs
-	arch arch.Arch
-	mem  *config.MemoryLayout
+	r       io.ReaderAt
+	Attr    *DfuSettingAttrs
+	arch    arch.Arch
+	mem     *config.MemoryLayout
+	symbols []elf.Symbol
+	closer  io.Closer
 }
 
+// OpenFirmware opens a firmware file. Raw binaries stay open and are read
+// on demand, so the caller owns the returned firmware and must Close it.
 func OpenFirmware(name string) (*Firmware, error) {
-	b, err := os.ReadFile(name)
+	f, err := openImage(name)
 	if err != nil {
 		return nil, err
 	}
-	r := bytes.NewReader(b)
+	fw, err := NewFirmware(f.r)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	fw.symbols = f.symbols
+	fw.closer = f
+	return fw, nil
+}
+
+// Close releases the file opened by OpenFirmware. It does nothing for
+// firmware created with NewFirmware.
+func (f *Firmware) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+// NewFirmware reads the DFU settings from a raw flash dump. Only the regions
+// that are needed are read from r.
+func NewFirmware(r io.ReaderAt) (*Firmware, error) {
 	attr, a, err := readSettingAttrs(r)
 	if err != nil {
 		return nil, err
@@ -43,6 +68,7 @@ func (f *Firmware) validArch() error {
 	if err != nil {
 		return err
 	}
+	f.mem = mem
 	addr := int64(mem.BootLoaderSettAddr)
 	if _, err := f.extractApp(addr); err != nil {
 		if !errors.Is(err, invalidCrc) {
@@ -82,6 +108,16 @@ func (f *Firmware) Arch() string {
 	return string(f.arch)
 }
 
+// Symbols returns the ELF symbol table, if the firmware was read from an ELF file.
+func (f *Firmware) Symbols() []elf.Symbol {
+	return f.symbols
+}
+
+// Lookup returns the ELF symbol whose range contains addr.
+func (f *Firmware) Lookup(addr uint32) (elf.Symbol, bool) {
+	return lookupSymbol(f.symbols, addr)
+}
+
 func (f *Firmware) ExtractApp() ([]byte, error) {
 	addr := int64(f.mem.AppAreaAddr)
 	return f.extractApp(addr)
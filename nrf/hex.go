@@ -2,16 +2,113 @@ package nrf
 
 import (
 	"bytes"
+	"debug/elf"
+	"fmt"
 	"io"
+	"os"
 
 	"github.com/marcinbor85/gohex"
 )
 
+// readImage converts ELF, Intel HEX, UF2 and S-record input to a flat binary starting at
+// address 0. Anything else is treated as a raw binary.
+func readImage(b []byte) ([]byte, []elf.Symbol, error) {
+	switch {
+	case isElfFile(b):
+		img, err := ReadElf(bytes.NewReader(b))
+		if err != nil {
+			return nil, nil, err
+		}
+		return img.Binary(), img.Symbols(), nil
+	case isIntelHex(b):
+		bin, err := HexFileToBinary(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bin, nil, nil
+	case isUF2File(b):
+		bin, err := UF2FileToBinary(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bin, nil, nil
+	case isSrecFile(b):
+		bin, err := SrecFileToBinary(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bin, nil, nil
+	}
+	return b, nil, nil
+}
+
+// imageFile is a firmware file opened by openImage.
+type imageFile struct {
+	r       io.ReaderAt
+	size    int64
+	symbols []elf.Symbol
+	// f is set for raw binaries, which are read in place.
+	f *os.File
+}
+
+// openImage opens a firmware file. Raw binaries are read on demand from the
+// open file, so multi-megabyte dumps are never loaded as a whole. ELF, Intel
+// HEX, UF2 and S-record files are converted in memory.
+func openImage(name string) (*imageFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, 0x200)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		f.Close()
+		return nil, err
+	}
+	head = head[:n]
+	if !isElfFile(head) && !isIntelHex(head) && !isUF2File(head) && !isSrecFile(head) {
+		st, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &imageFile{r: f, size: st.Size(), f: f}, nil
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	b, symbols, err := readImage(b)
+	if err != nil {
+		return nil, err
+	}
+	return &imageFile{r: bytes.NewReader(b), size: int64(len(b)), symbols: symbols}, nil
+}
+
+// Close closes the file of a raw binary.
+func (f *imageFile) Close() error {
+	if f.f == nil {
+		return nil
+	}
+	return f.f.Close()
+}
+
+// HexFileToBinary converts an Intel HEX or ELF file to a binary starting at
+// address 0.
 func HexFileToBinary(b []byte) ([]byte, error) {
+	if isElfFile(b) {
+		return ElfFileToBinary(b)
+	}
 	r := bytes.NewReader(b)
 	return intelHexToBinary(r, true)
 }
 
+func isIntelHex(b []byte) bool {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) > 0 && b[0] == ':'
+}
+
 func intelHexToBinary(r io.Reader, full bool) ([]byte, error) {
 	mem := gohex.NewMemory()
 	if err := mem.ParseIntelHex(r); err != nil {
@@ -33,3 +130,190 @@ func readSoftDevice(b []byte) ([]byte, error) {
 	r := bytes.NewReader(b)
 	return intelHexToBinary(r, false)
 }
+
+// MergeConflictError is returned when two merged images contain different
+// data at the same address.
+type MergeConflictError struct {
+	Addr uint32
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("merge: conflicting data at 0x%08x", e.Addr)
+}
+
+// FlashImage is a flash image assembled from one or more HEX or BIN images,
+// equivalent to the output of nrf mergehex.
+type FlashImage struct {
+	mem *gohex.Memory
+}
+
+func NewFlashImage() *FlashImage {
+	return &FlashImage{mem: gohex.NewMemory()}
+}
+
+// MergeHex overlays the given Intel HEX images in order.
+func MergeHex(images ...[]byte) (*FlashImage, error) {
+	f := NewFlashImage()
+	for _, b := range images {
+		if err := f.AddHex(b); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// AddHex overlays an Intel HEX image. Regions that overlap existing data are
+// accepted only if their contents are identical. The image is left unchanged
+// when any region conflicts.
+func (f *FlashImage) AddHex(b []byte) error {
+	mem := gohex.NewMemory()
+	if err := mem.ParseIntelHex(bytes.NewReader(b)); err != nil {
+		return err
+	}
+	var gaps []Segment
+	for _, segment := range mem.GetDataSegments() {
+		g, err := f.gaps(segment.Address, segment.Data)
+		if err != nil {
+			return err
+		}
+		gaps = append(gaps, g...)
+	}
+	if err := f.addSegments(gaps); err != nil {
+		return err
+	}
+	if addr, ok := mem.GetStartAddress(); ok {
+		f.mem.SetStartAddress(addr)
+	}
+	return nil
+}
+
+// AddBinary overlays raw data at addr. The image is left unchanged when the
+// data conflicts with existing data.
+func (f *FlashImage) AddBinary(addr uint32, b []byte) error {
+	gaps, err := f.gaps(addr, b)
+	if err != nil {
+		return err
+	}
+	return f.addSegments(gaps)
+}
+
+// gaps checks that b matches the existing data it overlaps and returns the
+// parts of b that are not in the image yet.
+func (f *FlashImage) gaps(addr uint32, b []byte) ([]Segment, error) {
+	if uint64(addr)+uint64(len(b)) > 1<<32 {
+		return nil, fmt.Errorf("data at 0x%08x exceeds the address space", addr)
+	}
+	end := addr + uint32(len(b))
+	cur := addr
+	var gaps []Segment
+	for _, segment := range f.mem.GetDataSegments() {
+		segEnd := segment.Address + uint32(len(segment.Data))
+		if segEnd <= cur || segment.Address >= end {
+			continue
+		}
+		if segment.Address > cur {
+			gaps = append(gaps, Segment{Address: cur, Data: b[cur-addr : segment.Address-addr]})
+			cur = segment.Address
+		}
+		last := min(end, segEnd)
+		data := segment.Data[cur-segment.Address : last-segment.Address]
+		for i, v := range b[cur-addr : last-addr] {
+			if data[i] != v {
+				return nil, &MergeConflictError{Addr: cur + uint32(i)}
+			}
+		}
+		cur = last
+	}
+	if cur < end {
+		gaps = append(gaps, Segment{Address: cur, Data: b[cur-addr:]})
+	}
+	return gaps, nil
+}
+
+func (f *FlashImage) addSegments(segments []Segment) error {
+	for _, segment := range segments {
+		if err := f.add(segment.Address, segment.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FlashImage) add(addr uint32, b []byte) error {
+	return f.mem.AddBinary(addr, bytes.Clone(b))
+}
+
+// codeFlashEnd bounds the code flash of nRF52 and nRF53 devices. Data above
+// it, such as UICR records at 0x10001000 (nRF52) or 0x00FF8000 (nRF53), is
+// kept out of the flat binary.
+const codeFlashEnd = 0x00FF8000
+
+// Segment is a contiguous block of image data.
+type Segment struct {
+	Address uint32
+	Data    []byte
+}
+
+// Size returns the end address of the last data segment in code flash.
+func (f *FlashImage) Size() uint32 {
+	var size uint32
+	for _, segment := range f.mem.GetDataSegments() {
+		if segment.Address >= codeFlashEnd {
+			break
+		}
+		size = min(segment.Address+uint32(len(segment.Data)), codeFlashEnd)
+	}
+	return size
+}
+
+// Binary returns the code flash image starting at address 0, padded with
+// 0xFF. Data outside code flash is returned by ExtraSegments.
+func (f *FlashImage) Binary() []byte {
+	return f.BinaryRange(0, f.Size())
+}
+
+// BinaryRange returns the image between start and end, padded with 0xFF.
+func (f *FlashImage) BinaryRange(start, end uint32) []byte {
+	if end <= start {
+		return nil
+	}
+	b := bytes.Repeat([]byte{0xFF}, int(end-start))
+	for _, segment := range f.mem.GetDataSegments() {
+		segEnd := segment.Address + uint32(len(segment.Data))
+		if segEnd <= start || segment.Address >= end {
+			continue
+		}
+		lo := max(segment.Address, start)
+		hi := min(segEnd, end)
+		copy(b[lo-start:], segment.Data[lo-segment.Address:hi-segment.Address])
+	}
+	return b
+}
+
+// ExtraSegments returns the data outside code flash, e.g. UICR.
+func (f *FlashImage) ExtraSegments() []Segment {
+	var out []Segment
+	for _, segment := range f.mem.GetDataSegments() {
+		segEnd := segment.Address + uint32(len(segment.Data))
+		if segEnd <= codeFlashEnd {
+			continue
+		}
+		addr := max(segment.Address, codeFlashEnd)
+		out = append(out, Segment{
+			Address: addr,
+			Data:    bytes.Clone(segment.Data[addr-segment.Address:]),
+		})
+	}
+	return out
+}
+
+// WriteHex writes the merged image in Intel HEX format.
+func (f *FlashImage) WriteHex(w io.Writer) error {
+	return f.mem.DumpIntelHex(w, 16)
+}
+
+// WriteBinary writes the code flash image as produced by Binary.
+func (f *FlashImage) WriteBinary(w io.Writer) error {
+	_, err := w.Write(f.Binary())
+	return err
+}
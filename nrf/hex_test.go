@@ -0,0 +1,61 @@
+package nrf
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFlashImageAddBinary(t *testing.T) {
+	f := NewFlashImage()
+	if err := f.AddBinary(0x1000, []byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddBinary(0x1008, []byte{9, 10, 11, 12}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Identical overlap fills the gap between the segments.
+	if err := f.AddBinary(0x1002, []byte{3, 4, 5, 6, 7, 8, 9, 10}); err != nil {
+		t.Fatalf("identical overlap: %v", err)
+	}
+	want := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	if got := f.BinaryRange(0x1000, 0x100c); !bytes.Equal(got, want) {
+		t.Fatalf("after gap fill = %v, want %v", got, want)
+	}
+
+	// A conflict after a gap leaves the image unchanged.
+	if err := f.AddBinary(0x0ffc, []byte{0xaa, 0xaa, 0xaa, 0xaa, 1, 2, 0xbb}); err == nil {
+		t.Fatal("conflicting overlap was accepted")
+	} else {
+		var mce *MergeConflictError
+		if !errors.As(err, &mce) || mce.Addr != 0x1002 {
+			t.Fatalf("err = %v, want a conflict at 0x1002", err)
+		}
+	}
+	if got := f.BinaryRange(0x0ffc, 0x100c); !bytes.Equal(got, append([]byte{0xff, 0xff, 0xff, 0xff}, want...)) {
+		t.Fatalf("image changed by a rejected merge: %v", got)
+	}
+
+	if err := f.AddBinary(0xfffffffe, []byte{1, 2, 3}); err == nil {
+		t.Fatal("data past the end of the address space was accepted")
+	}
+}
+
+func TestFlashImageBinarySkipsUICR(t *testing.T) {
+	f := NewFlashImage()
+	if err := f.AddBinary(0x0, []byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	uicr := []byte{0x00, 0x00, 0x0f, 0x00}
+	if err := f.AddBinary(0x10001014, uicr); err != nil {
+		t.Fatal(err)
+	}
+	if f.Size() != 4 {
+		t.Errorf("Size() = %#x, want 4", f.Size())
+	}
+	extra := f.ExtraSegments()
+	if len(extra) != 1 || extra[0].Address != 0x10001014 || !bytes.Equal(extra[0].Data, uicr) {
+		t.Errorf("ExtraSegments() = %+v", extra)
+	}
+}
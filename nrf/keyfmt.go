@@ -0,0 +1,408 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// KeyFormat is an encoding of a public key.
+type KeyFormat int
+
+const (
+	// KeyRawBE is a big-endian P-256 X||Y or a raw Ed25519/X25519 key.
+	// 32 byte raw keys are parsed as Ed25519.
+	KeyRawBE KeyFormat = iota
+	// KeyRawBE04 is KeyRawBE with the 0x04 uncompressed point prefix.
+	KeyRawBE04
+	// KeyRawLE is the little-endian X||Y used by the nRF5 SDK bootloader.
+	KeyRawLE
+	// KeyRawLE04 is KeyRawLE with a 0x04 prefix.
+	KeyRawLE04
+	// KeyDER is SubjectPublicKeyInfo. PKCS#1 RSA keys are accepted too.
+	KeyDER
+	// KeyPEM is a PEM "PUBLIC KEY" block. "RSA PUBLIC KEY" blocks are
+	// accepted too.
+	KeyPEM
+	KeyJWK
+	// KeyNRF5C is the pk array of the nRF5 SDK dfu_public_key.c.
+	KeyNRF5C
+	// KeyMCUBootC is the key array of MCUboot's keys.c as written by
+	// imgtool getpub. RSA keys are PKCS#1, the others SubjectPublicKeyInfo.
+	KeyMCUBootC
+	// KeyPKCS1 is a DER RSAPublicKey, the form MCUboot embeds and
+	// DumpVerifyingKey returns for RSA keys.
+	KeyPKCS1
+)
+
+var keyFormatNames = map[KeyFormat]string{
+	KeyRawBE:    "raw",
+	KeyRawBE04:  "raw04",
+	KeyRawLE:    "rawle",
+	KeyRawLE04:  "rawle04",
+	KeyDER:      "der",
+	KeyPEM:      "pem",
+	KeyJWK:      "jwk",
+	KeyNRF5C:    "nrf5c",
+	KeyMCUBootC: "mcubootc",
+	KeyPKCS1:    "pkcs1",
+}
+
+func (f KeyFormat) String() string {
+	if s, ok := keyFormatNames[f]; ok {
+		return s
+	}
+	return fmt.Sprintf("KeyFormat(%d)", int(f))
+}
+
+// ParseKeyFormat returns the format named by KeyFormat.String.
+func ParseKeyFormat(s string) (KeyFormat, error) {
+	for f, name := range keyFormatNames {
+		if strings.EqualFold(s, name) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown key format %q", s)
+}
+
+// MarshalPublicKey encodes an *ecdsa.PublicKey, *rsa.PublicKey,
+// ed25519.PublicKey or *ecdh.PublicKey in the given format.
+func MarshalPublicKey(key any, format KeyFormat) ([]byte, error) {
+	switch format {
+	case KeyRawBE, KeyRawBE04, KeyRawLE, KeyRawLE04:
+		return marshalRawKey(key, format)
+	case KeyDER:
+		return x509.MarshalPKIXPublicKey(key)
+	case KeyPEM:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+	case KeyPKCS1:
+		pk, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("pkcs1 keys must be rsa")
+		}
+		return x509.MarshalPKCS1PublicKey(pk), nil
+	case KeyJWK:
+		return marshalJWK(key)
+	case KeyNRF5C:
+		raw, err := marshalRawKey(key, KeyRawLE)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) != nrf5KeySize {
+			return nil, errors.New("nrf5 bootloader keys must be P-256")
+		}
+		var buf bytes.Buffer
+		buf.WriteString("#include \"stdint.h\"\n")
+		buf.WriteString("#include \"compiler_abstraction.h\"\n\n")
+		buf.WriteString("/** @brief Public key used to verify DFU images */\n")
+		buf.WriteString("__ALIGN(4) const uint8_t pk[64] =\n{\n")
+		writeCArray(&buf, raw, 16)
+		buf.WriteString("};\n")
+		return buf.Bytes(), nil
+	case KeyMCUBootC:
+		der, err := marshalMCUBootKey(key)
+		if err != nil {
+			return nil, err
+		}
+		name, err := mcuBootKeyName(key)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "const unsigned char %s[] = {\n", name)
+		writeCArray(&buf, der, 8)
+		fmt.Fprintf(&buf, "};\nconst unsigned int %s_len = %d;\n", name, len(der))
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported key format %v", format)
+}
+
+// ParsePublicKeyFormat decodes a public key written in the given format.
+func ParsePublicKeyFormat(b []byte, format KeyFormat) (any, error) {
+	switch format {
+	case KeyRawBE, KeyRawBE04:
+		return parseRawKey(b, false)
+	case KeyRawLE, KeyRawLE04:
+		return parseRawKey(b, true)
+	case KeyDER:
+		return parseDERKey(b)
+	case KeyPKCS1:
+		return loadRsaKey(b)
+	case KeyPEM:
+		block, _ := pem.Decode(b)
+		if block == nil || block.Type != "PUBLIC KEY" && block.Type != "RSA PUBLIC KEY" {
+			return nil, errors.New("invalid block or block type")
+		}
+		return parseDERKey(block.Bytes)
+	case KeyJWK:
+		return parseJWK(b)
+	case KeyNRF5C:
+		raw, err := parseCArray(b)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) != nrf5KeySize {
+			return nil, errors.New("invalid nrf5 public key size")
+		}
+		return parseRawKey(raw, true)
+	case KeyMCUBootC:
+		der, err := parseCArray(b)
+		if err != nil {
+			return nil, err
+		}
+		return parsePublicKey(der)
+	}
+	return nil, fmt.Errorf("unsupported key format %v", format)
+}
+
+// ConvertPublicKey converts a key between two formats.
+func ConvertPublicKey(b []byte, from, to KeyFormat) ([]byte, error) {
+	key, err := ParsePublicKeyFormat(b, from)
+	if err != nil {
+		return nil, err
+	}
+	return MarshalPublicKey(key, to)
+}
+
+// Marshal encodes the key in the given format.
+func (vk *VerifyingKey) Marshal(format KeyFormat) ([]byte, error) {
+	return MarshalPublicKey(vk.Key, format)
+}
+
+// parseDERKey parses SubjectPublicKeyInfo and falls back to PKCS#1 for the
+// RSA keys MCUboot embeds.
+func parseDERKey(b []byte) (any, error) {
+	key, err := x509.ParsePKIXPublicKey(b)
+	if err == nil {
+		return key, nil
+	}
+	if key, err := loadRsaKey(b); err == nil {
+		return key, nil
+	}
+	return nil, err
+}
+
+func marshalRawKey(key any, format KeyFormat) ([]byte, error) {
+	var raw []byte
+	switch pk := key.(type) {
+	case *ecdsa.PublicKey:
+		if pk.Curve != elliptic.P256() {
+			return nil, errors.New("raw keys must be P-256")
+		}
+		raw = make([]byte, nrf5KeySize)
+		pk.X.FillBytes(raw[:0x20])
+		pk.Y.FillBytes(raw[0x20:])
+		if format == KeyRawLE || format == KeyRawLE04 {
+			raw = reverseP256Key(raw)
+		}
+		if format == KeyRawBE04 || format == KeyRawLE04 {
+			raw = append([]byte{0x04}, raw...)
+		}
+		return raw, nil
+	case ed25519.PublicKey:
+		return append([]byte(nil), pk...), nil
+	case *ecdh.PublicKey:
+		if pk.Curve() == ecdh.X25519() {
+			return pk.Bytes(), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported raw key type %T", key)
+}
+
+func parseRawKey(b []byte, le bool) (any, error) {
+	switch len(b) {
+	case 0x20:
+		return ed25519.PublicKey(append([]byte(nil), b...)), nil
+	case 0x41:
+		if b[0] != 0x04 {
+			return nil, errors.New("invalid ecdsa public key prefix")
+		}
+		b = b[1:]
+	}
+	if len(b) != nrf5KeySize {
+		return nil, errors.New("invalid raw public key size")
+	}
+	if le {
+		b = reverseP256Key(b)
+	}
+	if _, err := ecdh.P256().NewPublicKey(append([]byte{0x04}, b...)); err != nil {
+		return nil, err
+	}
+	return setP256PublicKey(b)
+}
+
+func mcuBootKeyName(key any) (string, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return "rsa_pub_key", nil
+	case *ecdsa.PublicKey:
+		return "ecdsa_pub_key", nil
+	case ed25519.PublicKey:
+		return "ed25519_pub_key", nil
+	case *ecdh.PublicKey:
+		return "x25519_pub_key", nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", key)
+}
+
+func writeCArray(buf *bytes.Buffer, b []byte, perLine int) {
+	for i := 0; i < len(b); i += perLine {
+		line := b[i:min(i+perLine, len(b))]
+		buf.WriteString("    ")
+		for j, c := range line {
+			if j > 0 {
+				buf.WriteByte(' ')
+			}
+			fmt.Fprintf(buf, "0x%02x,", c)
+		}
+		buf.WriteByte('\n')
+	}
+}
+
+var cArrayByte = regexp.MustCompile(`0[xX]([0-9a-fA-F]{1,2})\b`)
+
+func parseCArray(b []byte) ([]byte, error) {
+	start := bytes.IndexByte(b, '{')
+	end := bytes.LastIndexByte(b, '}')
+	if start < 0 || end < start {
+		return nil, errors.New("c array not found")
+	}
+	body := b[start+1 : end]
+	var out []byte
+	for _, m := range cArrayByte.FindAllSubmatch(body, -1) {
+		v, err := strconv.ParseUint(string(m[1]), 16, 8)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, byte(v))
+	}
+	if len(out) == 0 {
+		return nil, errors.New("c array is empty")
+	}
+	return out, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+var jwkCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func marshalJWK(key any) ([]byte, error) {
+	enc := base64.RawURLEncoding.EncodeToString
+	var k jwk
+	switch pk := key.(type) {
+	case *ecdsa.PublicKey:
+		size := (pk.Curve.Params().BitSize + 7) / 8
+		k = jwk{
+			Kty: "EC",
+			Crv: pk.Curve.Params().Name,
+			X:   enc(pk.X.FillBytes(make([]byte, size))),
+			Y:   enc(pk.Y.FillBytes(make([]byte, size))),
+		}
+	case *rsa.PublicKey:
+		k = jwk{
+			Kty: "RSA",
+			N:   enc(pk.N.Bytes()),
+			E:   enc(big.NewInt(int64(pk.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		k = jwk{Kty: "OKP", Crv: "Ed25519", X: enc(pk)}
+	case *ecdh.PublicKey:
+		if pk.Curve() != ecdh.X25519() {
+			return nil, errors.New("unsupported ecdh curve")
+		}
+		k = jwk{Kty: "OKP", Crv: "X25519", X: enc(pk.Bytes())}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return json.Marshal(k)
+}
+
+func parseJWK(b []byte) (any, error) {
+	var k jwk
+	if err := json.Unmarshal(b, &k); err != nil {
+		return nil, err
+	}
+	dec := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "EC":
+		curve, ok := jwkCurves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported jwk curve %q", k.Crv)
+		}
+		x, err := dec(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := dec(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pk := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		// ECDH rejects points that are not on the curve.
+		if _, err := pk.ECDH(); err != nil {
+			return nil, err
+		}
+		return pk, nil
+	case "RSA":
+		n, err := dec(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := dec(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "OKP":
+		x, err := dec(k.X)
+		if err != nil {
+			return nil, err
+		}
+		switch k.Crv {
+		case "Ed25519":
+			if len(x) != ed25519.PublicKeySize {
+				return nil, errors.New("invalid ed25519 public key size")
+			}
+			return ed25519.PublicKey(x), nil
+		case "X25519":
+			return ecdh.X25519().NewPublicKey(x)
+		}
+		return nil, fmt.Errorf("unsupported jwk curve %q", k.Crv)
+	}
+	return nil, fmt.Errorf("unsupported jwk key type %q", k.Kty)
+}
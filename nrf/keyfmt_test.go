@@ -0,0 +1,104 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestConvertPublicKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := []KeyFormat{KeyRawBE, KeyRawBE04, KeyRawLE, KeyRawLE04, KeyDER, KeyPEM, KeyJWK, KeyNRF5C, KeyMCUBootC}
+	for _, tt := range []struct {
+		name    string
+		key     crypto.PublicKey
+		formats []KeyFormat
+	}{
+		{"P-256", &ecKey.PublicKey, all},
+		{"RSA-2048", &rsaKey.PublicKey, []KeyFormat{KeyDER, KeyPEM, KeyJWK, KeyMCUBootC, KeyPKCS1}},
+		{"Ed25519", edPub, []KeyFormat{KeyRawBE, KeyDER, KeyPEM, KeyJWK, KeyMCUBootC}},
+	} {
+		for _, f := range tt.formats {
+			b, err := MarshalPublicKey(tt.key, f)
+			if err != nil {
+				t.Errorf("%s: MarshalPublicKey(%v): %v", tt.name, f, err)
+				continue
+			}
+			key, err := ParsePublicKeyFormat(b, f)
+			if err != nil {
+				t.Errorf("%s: ParsePublicKeyFormat(%v): %v", tt.name, f, err)
+				continue
+			}
+			if !key.(interface{ Equal(crypto.PublicKey) bool }).Equal(tt.key) {
+				t.Errorf("%s: key differs after a %v round trip", tt.name, f)
+			}
+		}
+	}
+
+	be, err := MarshalPublicKey(&ecKey.PublicKey, KeyRawBE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	le, err := ConvertPublicKey(be, KeyRawBE, KeyRawLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// X and Y are reversed separately.
+	x, y := slices.Clone(be[:32]), slices.Clone(be[32:])
+	slices.Reverse(x)
+	slices.Reverse(y)
+	if !bytes.Equal(le, append(x, y...)) {
+		t.Error("little-endian key is not X and Y reversed")
+	}
+	c, err := ConvertPublicKey(le, KeyRawLE, KeyNRF5C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(c), "const uint8_t pk[64]") {
+		t.Errorf("nrf5 source:\n%s", c)
+	}
+	c, err = MarshalPublicKey(&rsaKey.PublicKey, KeyMCUBootC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(c), "rsa_pub_key[]") || !strings.Contains(string(c), "rsa_pub_key_len = 270;") {
+		t.Errorf("mcuboot source:\n%s", c)
+	}
+
+	if _, err := MarshalPublicKey(&rsaKey.PublicKey, KeyNRF5C); err == nil {
+		t.Error("rsa key written as an nrf5 key")
+	}
+	if _, err := ParsePublicKeyFormat(make([]byte, 64), KeyRawBE); err == nil {
+		t.Error("point not on the curve was accepted")
+	}
+}
+
+func TestParseKeyFormat(t *testing.T) {
+	for f, name := range keyFormatNames {
+		got, err := ParseKeyFormat(strings.ToUpper(name))
+		if err != nil || got != f {
+			t.Errorf("ParseKeyFormat(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParseKeyFormat("ssh"); err == nil {
+		t.Error("unknown format was accepted")
+	}
+}
@@ -0,0 +1,232 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+//go:embed sig/keys.json
+var defaultKeys []byte
+
+// KnownKey is a named public key, such as a sample key shipped with an SDK
+// or a key known to be leaked.
+type KnownKey struct {
+	Name  string `json:"name"`
+	Suite string `json:"suite"`
+	Note  string `json:"note,omitempty"`
+	// PublicKey is the hex encoded key as embedded by MCUboot: PKCS#1 for
+	// RSA keys, SubjectPublicKeyInfo for the others.
+	PublicKey string `json:"publicKey"`
+	// Fingerprint is the hex encoded SHA256 of the decoded PublicKey.
+	Fingerprint string `json:"fingerprint"`
+
+	der []byte
+	key any
+}
+
+// KeyRegistry is a database of known public keys.
+type KeyRegistry struct {
+	Keys []*KnownKey `json:"keys"`
+}
+
+// DefaultKeyRegistry returns a copy of the registry bundled with go-nrf.
+func DefaultKeyRegistry() (*KeyRegistry, error) {
+	return ReadKeyRegistry(bytes.NewReader(defaultKeys))
+}
+
+// LoadKeyRegistry loads a registry from a JSON file.
+func LoadKeyRegistry(name string) (*KeyRegistry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadKeyRegistry(f)
+}
+
+// ReadKeyRegistry decodes a registry.
+func ReadKeyRegistry(rd io.Reader) (*KeyRegistry, error) {
+	var r KeyRegistry
+	if err := json.NewDecoder(rd).Decode(&r); err != nil {
+		return nil, err
+	}
+	for _, k := range r.Keys {
+		if err := k.init(); err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Name, err)
+		}
+	}
+	return &r, nil
+}
+
+func (k *KnownKey) init() error {
+	der, err := hex.DecodeString(k.PublicKey)
+	if err != nil {
+		return err
+	}
+	key, err := parsePublicKey(der)
+	if err != nil {
+		return err
+	}
+	fp := hex.EncodeToString(sha256Sum(der))
+	if k.Fingerprint == "" {
+		k.Fingerprint = fp
+	} else if k.Fingerprint != fp {
+		return errors.New("fingerprint does not match the public key")
+	}
+	k.der = der
+	k.key = key
+	return nil
+}
+
+// Merge adds the keys of o that are not in r yet.
+func (r *KeyRegistry) Merge(o *KeyRegistry) {
+	for _, k := range o.Keys {
+		if !slices.ContainsFunc(r.Keys, func(e *KnownKey) bool {
+			return e.Fingerprint == k.Fingerprint
+		}) {
+			r.Keys = append(r.Keys, k)
+		}
+	}
+}
+
+// Add registers a PEM, DER or raw public key under name. PEM private keys,
+// such as MCUboot's root-*.pem sample keys, are accepted too and only their
+// public key is kept.
+func (r *KeyRegistry) Add(name, note string, key []byte) (*KnownKey, error) {
+	var pk any
+	if priv, err := parsePrivateKey(key); err == nil {
+		signer, ok := priv.(interface{ Public() crypto.PublicKey })
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key %T", priv)
+		}
+		pk = signer.Public()
+	} else if pk, err = parsePublicKey(key); err != nil {
+		return nil, err
+	}
+	der, err := marshalMCUBootKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	k := &KnownKey{
+		Name:      name,
+		Suite:     keySuiteName(pk),
+		Note:      note,
+		PublicKey: hex.EncodeToString(der),
+	}
+	if err := k.init(); err != nil {
+		return nil, err
+	}
+	r.Keys = append(r.Keys, k)
+	return k, nil
+}
+
+// Save writes the registry as JSON.
+func (r *KeyRegistry) Save(name string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0644)
+}
+
+func keySuiteName(key any) string {
+	switch pk := key.(type) {
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ecdsaP%d", pk.Curve.Params().BitSize)
+	case ed25519.PublicKey:
+		return "ed25519"
+	}
+	if der, err := marshalMCUBootKey(key); err == nil {
+		for _, suite := range keySuites {
+			if bytes.HasPrefix(der, suite.magic) {
+				return suite.name
+			}
+		}
+	}
+	return "unknown"
+}
+
+// Match returns the known key equal to a PEM, DER or raw public key.
+func (r *KeyRegistry) Match(key []byte) (*KnownKey, bool) {
+	pk, err := parsePublicKey(key)
+	if err != nil {
+		return nil, false
+	}
+	der, err := marshalMCUBootKey(pk)
+	if err != nil {
+		return nil, false
+	}
+	return r.MatchFingerprint(sha256Sum(der))
+}
+
+// MatchFingerprint returns the known key with the given SHA256 fingerprint.
+func (r *KeyRegistry) MatchFingerprint(fp []byte) (*KnownKey, bool) {
+	want := hex.EncodeToString(fp)
+	for _, k := range r.Keys {
+		if k.Fingerprint == want {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// MatchVerifyingKey returns the known key found by DumpVerifyingKey,
+// FindVerifyingKeys or FindNRF5PublicKeys.
+func (r *KeyRegistry) MatchVerifyingKey(vk *VerifyingKey) (*KnownKey, bool) {
+	der, err := marshalMCUBootKey(vk.Key)
+	if err != nil {
+		return nil, false
+	}
+	return r.MatchFingerprint(sha256Sum(der))
+}
+
+// FindVerifyingKeys is FindVerifyingKeys with Known set on registered keys.
+func (r *KeyRegistry) FindVerifyingKeys(b []byte) []*VerifyingKey {
+	keys := FindVerifyingKeys(b)
+	for _, vk := range keys {
+		vk.Known, _ = r.MatchVerifyingKey(vk)
+	}
+	return keys
+}
+
+// DumpVerifyingKey returns the first valid verifying key in b and the
+// registered key it matches, if any.
+func (r *KeyRegistry) DumpVerifyingKey(b []byte) (*VerifyingKey, error) {
+	keys := r.FindVerifyingKeys(b)
+	if len(keys) == 0 {
+		return nil, errors.New("verifying key not found")
+	}
+	return keys[0], nil
+}
+
+// MatchTLVArea returns the known key referenced by the KEYHASH or PUBKEY
+// TLV of an MCUboot image.
+func (r *KeyRegistry) MatchTLVArea(a *TLVArea) (*KnownKey, bool) {
+	for _, k := range r.Keys {
+		if a.VerifyPK(k.der) {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// VerifyDfu verifies the init packet with every known key and returns the
+// one that signed it.
+func (r *KeyRegistry) VerifyDfu(d *DfuInfo) (*KnownKey, error) {
+	for _, k := range r.Keys {
+		if d.Verify(k.der) == nil {
+			return k, nil
+		}
+	}
+	return nil, errors.New("dfu: not signed by a known key")
+}
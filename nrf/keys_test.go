@@ -0,0 +1,63 @@
+package nrf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDefaultKeyRegistry(t *testing.T) {
+	r, err := DefaultKeyRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Keys) == 0 {
+		t.Fatal("the bundled registry is empty")
+	}
+	for _, k := range r.Keys {
+		if got := keySuiteName(k.key); got != k.Suite {
+			t.Errorf("%s: suite %s, key is %s", k.Name, k.Suite, got)
+		}
+		fp, err := hex.DecodeString(k.Fingerprint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m, ok := r.MatchFingerprint(fp); !ok || m != k {
+			t.Errorf("%s: fingerprint does not match", k.Name)
+		}
+		// An image signed with the sample key carries its hash in KEYHASH.
+		img := buildTestImage([]byte{1, 2, 3, 4}, nil, []testTLV{
+			{ImageTLVSHA256, make([]byte, 32)},
+			{ImageTLVKeyHash, fp},
+		})
+		area, err := openTestImage(t, img).ReadTLVArea()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m, ok := r.MatchTLVArea(area); !ok || m != k {
+			t.Errorf("%s: KEYHASH does not match", k.Name)
+		}
+	}
+	if _, ok := r.MatchFingerprint(make([]byte, 32)); ok {
+		t.Error("matched an unknown fingerprint")
+	}
+}
+
+func TestKeyRegistryAdd(t *testing.T) {
+	r := &KeyRegistry{}
+	key := generateTestKey(t, "P-384")
+	k, err := r.Add("test", "", privateKeyPEM(t, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Suite != "ecdsaP384" {
+		t.Errorf("suite = %s, want ecdsaP384", k.Suite)
+	}
+	if m, ok := r.Match(publicKeyPEM(t, key.Public())); !ok || m != k {
+		t.Error("public key does not match the added private key")
+	}
+	if _, err := ReadKeyRegistry(bytes.NewReader([]byte(`{"keys": [{"name": "bad",
+		"publicKey": "` + k.PublicKey + `", "fingerprint": "00"}]}`))); err == nil {
+		t.Error("registry with a wrong fingerprint was accepted")
+	}
+}
@@ -2,12 +2,12 @@ package nrf
 
 import (
 	"bytes"
+	"crypto/sha512"
 	"crypto/subtle"
+	"debug/elf"
 	"encoding/binary"
 	"errors"
-	"fmt"
 	"io"
-	"os"
 )
 
 type MCUBootImgHeader struct {
@@ -54,12 +54,16 @@ type TLVType int
 
 const (
 	ImageTLVKeyHash       TLVType = 0x01 // hash of the public key
+	ImageTLVPubKey        TLVType = 0x02 // public key
 	ImageTLVSHA256        TLVType = 0x10 // SHA256 of image hdr and body
+	ImageTLVSHA384        TLVType = 0x11 // SHA384 of image hdr and body
+	ImageTLVSHA512        TLVType = 0x12 // SHA512 of image hdr and body
 	ImageTLVRsa2048PSS    TLVType = 0x20 // RSA2048 of hash output
 	ImageTLVEcdsa224      TLVType = 0x21 // ECDSA of hash output - Not supported anymore
 	ImageTLVEcdsaSig      TLVType = 0x22 // ECDSA of hash output
 	ImageTLVRsa3072PSS    TLVType = 0x23 // RSA3072 of hash output
 	ImageTLVED25519       TLVType = 0x24 // ED25519 of hash output
+	ImageTLVSigPure       TLVType = 0x25 // signature is over the image itself, not its hash
 	ImageTLVEncRsa2048    TLVType = 0x30 // Key encrypted with RSA-OAEP-2048
 	ImageTLVEncKW         TLVType = 0x31 // Key encrypted with AES-KW-128 or 256
 	ImageTLVEncEC256      TLVType = 0x32 // Key encrypted with ECIES-P256
@@ -70,68 +74,119 @@ const (
 )
 
 type MCUBoot struct {
-	r      io.ReaderAt
-	base   int64
-	offset int64
+	r    io.ReaderAt
+	base int64
 
-	header *MCUBootImgHeader
+	header  *MCUBootImgHeader
+	symbols []elf.Symbol
+	closer  io.Closer
 }
 
+var mcuBootImageMagic = []byte{0x3D, 0xB8, 0xF3, 0x96}
+
+// DetectMCUBoot opens the file and finds the first MCUboot image in it.
+// Raw binaries stay open and are read on demand, so the caller owns the
+// returned image and must Close it.
 func DetectMCUBoot(name string) (*MCUBoot, error) {
-	b, err := os.ReadFile(name)
+	f, err := openImage(name)
+	if err != nil {
+		return nil, err
+	}
+	boot, err := NewMCUBoot(f.r, f.size)
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
-	return detectMCUBoot(b)
+	boot.symbols = f.symbols
+	boot.closer = f
+	return boot, nil
+}
+
+// Close releases the file opened by DetectMCUBoot. It does nothing for
+// images created from an io.ReaderAt.
+func (b *MCUBoot) Close() error {
+	if b.closer == nil {
+		return nil
+	}
+	return b.closer.Close()
 }
 
 func detectMCUBoot(b []byte) (*MCUBoot, error) {
-	offsets := findMCUBootImageMagic(b)
-	var header MCUBootImgHeader
-	var off int64
-	for _, offset := range offsets {
-		if !isMCUBootImageHeader(b, offset) {
-			continue
-		}
-		r := bytes.NewReader(b[offset : offset+0x20])
-		err := binary.Read(r, binary.LittleEndian, &header)
+	return NewMCUBoot(bytes.NewReader(b), int64(len(b)))
+}
+
+// NewMCUBoot finds the first MCUboot image in the first size bytes of r.
+// The image is scanned in chunks and never read into memory as a whole.
+func NewMCUBoot(r io.ReaderAt, size int64) (*MCUBoot, error) {
+	var boot *MCUBoot
+	err := scanMagic(r, size, mcuBootImageMagic, func(offset int64) bool {
+		header, err := readMCUBootImgHeader(r, offset, size)
 		if err != nil {
-			return nil, err
+			return true
 		}
-		off = offset
-		break
+		boot = &MCUBoot{r: r, base: offset, header: header}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if boot == nil {
+		return nil, errors.New("mcu-boot: image header not found")
 	}
-	r := bytes.NewReader(b)
-	boot := &MCUBoot{r: r, base: off, header: &header}
 	return boot, nil
 }
 
-func findMCUBootImageMagic(b []byte) []int64 {
-	magic := []byte{0x3D, 0xB8, 0xF3, 0x96}
-	r := make([]int64, 0)
-	idx := 0
-	for {
-		offset := bytes.Index(b[idx:], magic)
-		if offset == -1 {
-			break
-		}
-		r = append(r, int64(idx+offset))
-		idx += offset + 1
+func findMCUBootImageMagic(r io.ReaderAt, size int64) ([]int64, error) {
+	offsets := make([]int64, 0)
+	err := scanMagic(r, size, mcuBootImageMagic, func(off int64) bool {
+		offsets = append(offsets, off)
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
-	return r
+	return offsets, nil
 }
 
-func isMCUBootImageHeader(b []byte, off int64) bool {
-	offset := off + 0x20
-	data := b[offset : offset+0x1E0]
-	pad := bytes.Repeat([]byte{0xFF}, 0x1E0)
-	return bytes.Equal(data, pad)
+// readMCUBootImgHeader reads the header at off and confirms it by the TLV
+// info magic that follows the image body.
+func readMCUBootImgHeader(r io.ReaderAt, off, size int64) (*MCUBootImgHeader, error) {
+	h := make([]byte, 0x20)
+	if _, err := r.ReadAt(h, off); err != nil {
+		return nil, err
+	}
+	var header MCUBootImgHeader
+	if err := binary.Read(bytes.NewReader(h), binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Size < 0x20 {
+		return nil, errors.New("mcu-boot: invalid header size")
+	}
+	tlvOff := off + int64(header.Size) + int64(header.ImgSize)
+	if tlvOff+4 > size {
+		return nil, errors.New("mcu-boot: image exceeds the input")
+	}
+	ti := make([]byte, 2)
+	if _, err := r.ReadAt(ti, tlvOff); err != nil {
+		return nil, err
+	}
+	magic := binary.LittleEndian.Uint16(ti)
+	if header.ProtectedTLVSize != 0 && magic != imageTLVProtInfoMagic ||
+		header.ProtectedTLVSize == 0 && magic != imageTLVInfoMagic {
+		return nil, errors.New("mcu-boot: invalid tlv image magic")
+	}
+	return &header, nil
 }
 
 func (b *MCUBoot) Header() *MCUBootImgHeader {
 	return b.header
 }
 
+// Symbols returns the ELF symbol table, if the image was read from an ELF file.
+func (b *MCUBoot) Symbols() []elf.Symbol {
+	return b.symbols
+}
+
 func (m *MCUBootImgHeader) checkFlags() []string {
 	flags := make([]string, 0)
 	for k, v := range imageFlags {
@@ -160,82 +215,24 @@ func (b *MCUBoot) ExtractImage() ([]byte, error) {
 	return img, nil
 }
 
-func (b *MCUBoot) seek(x int64) {
-	b.offset += x
-}
-
-type TLVArea struct {
-	ImageHash []byte
-	KeyHash   []byte
-	Signature []byte
-}
-
-func (b *MCUBoot) ReadTLVArea() (*TLVArea, error) {
-	offset := b.base + int64(b.header.Size) + int64(b.header.ImgSize)
-	b.offset = offset
-	ti := make([]byte, 4)
-	_, err := b.r.ReadAt(ti, b.offset)
-	if err != nil {
-		return nil, err
-	}
-	var tlvInfo ImageTLVInfo
-	r := bytes.NewReader(ti)
-	err = binary.Read(r, binary.LittleEndian, &tlvInfo)
-	if err != nil {
-		return nil, err
-	}
-	if tlvInfo.Magic != 0x6907 && tlvInfo.Magic != 0x6908 {
-		return nil, errors.New("mcu-boot: invalid tlv image magic")
-	}
-	if b.header.ProtectedTLVSize != 0 && tlvInfo.Magic == 0x6908 {
-		// TODO: parse protectedTLVs
-		fmt.Println("Protected!!!")
-	}
-	b.seek(4)
-	h, t, err := b.readTLVAreaInfo()
-	if t != ImageTLVSHA256 {
-		return nil, errors.New("mcu-boot: invalid tlv hash")
-	}
-	kh, t, err := b.readTLVAreaInfo()
-	if err != nil {
-		return nil, err
-	}
-	if t != ImageTLVKeyHash {
-		return nil, errors.New("mcu-boot: invalid tlv key hash")
-	}
-	sig, _, err := b.readTLVAreaInfo()
-	if err != nil {
-		return nil, err
-	}
-	area := &TLVArea{ImageHash: h, KeyHash: kh, Signature: sig}
-	return area, nil
-}
-
-func (b *MCUBoot) readTLVAreaInfo() ([]byte, TLVType, error) {
-	it := make([]byte, 4)
-	if _, err := b.r.ReadAt(it, b.offset); err != nil {
-		return nil, -1, err
-	}
-	var tlv ImageTLV
-	r := bytes.NewReader(it)
-	err := binary.Read(r, binary.LittleEndian, &tlv)
-	if err != nil {
-		return nil, -1, err
-	}
-	b.seek(4)
-	out := make([]byte, tlv.ItSize)
-	if _, err := b.r.ReadAt(out, b.offset); err != nil {
-		return nil, -1, err
-	}
-	b.seek(int64(tlv.ItSize))
-	return out, TLVType(tlv.ItType), nil
-}
-
 func (a *TLVArea) VerifyPK(key []byte) bool {
 	size := len(key)
 	if size != 0x18e && size != 0x10e && size != 0x78 && size != 0x5b && size != 0x2c {
 		return false
 	}
-	h := sha256Sum(key)
+	if a.KeyHash == nil && a.PublicKey != nil {
+		return subtle.ConstantTimeCompare(key, a.PublicKey) != 0
+	}
+	var h []byte
+	switch len(a.KeyHash) {
+	case sha512.Size384:
+		sum := sha512.Sum384(key)
+		h = sum[:]
+	case sha512.Size:
+		sum := sha512.Sum512(key)
+		h = sum[:]
+	default:
+		h = sha256Sum(key)
+	}
 	return subtle.ConstantTimeCompare(h, a.KeyHash) != 0
 }
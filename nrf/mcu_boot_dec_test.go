@@ -0,0 +1,126 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"testing"
+)
+
+// encryptTestImage encrypts body with aesKey and lays it out with the given
+// ENC TLV, flagged as an AES-128 image.
+func encryptTestImage(t *testing.T, body, aesKey []byte, enc testTLV) []byte {
+	t.Helper()
+	c, err := aes.NewCipher(aesKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := make([]byte, len(body))
+	cipher.NewCTR(c, make([]byte, aes.BlockSize)).XORKeyStream(ct, body)
+	// The hash covers the plaintext; Decrypt does not check it.
+	img := buildTestImage(ct, nil, []testTLV{{ImageTLVSHA256, make([]byte, 32)}, enc})
+	binary.LittleEndian.PutUint32(img[16:], imageFlags["EncryptedAes128"])
+	return img
+}
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecryptMCUBoot(t *testing.T) {
+	body := bytes.Repeat([]byte("plaintext image "), 0x10)
+
+	// RFC 3394 4.1: a 128-bit key wrapped with a 128-bit KEK.
+	kek := unhex(t, "000102030405060708090A0B0C0D0E0F")
+	aesKey := unhex(t, "00112233445566778899AABBCCDDEEFF")
+	wrapped := unhex(t, "1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaEnc, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &rsaKey.PublicKey, aesKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	// ECIES-X25519: ephemeral public key, HMAC tag, then the key in AES-CTR.
+	xKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := eph.ECDH(xKey.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	derived := hkdfSha256(secret, nil, []byte("MCUBoot_ECIES_v1"), 16+sha256.Size)
+	c, err := aes.NewCipher(derived[:16])
+	if err != nil {
+		t.Fatal(err)
+	}
+	encKey := make([]byte, 16)
+	cipher.NewCTR(c, make([]byte, aes.BlockSize)).XORKeyStream(encKey, aesKey)
+	mac := hmac.New(sha256.New, derived[16:])
+	mac.Write(encKey)
+	xTLV := append(append(eph.PublicKey().Bytes(), mac.Sum(nil)...), encKey...)
+	xDER, err := x509.MarshalPKCS8PrivateKey(xKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: xDER})
+
+	tests := []struct {
+		name string
+		enc  testTLV
+		key  []byte
+	}{
+		{"aes-kw", testTLV{ImageTLVEncKW, wrapped}, kek},
+		{"rsa-oaep", testTLV{ImageTLVEncRsa2048, rsaEnc}, rsaPEM},
+		{"x25519", testTLV{ImageTLVEncX25519, xTLV}, xPEM},
+	}
+	for _, tt := range tests {
+		img := encryptTestImage(t, body, aesKey, tt.enc)
+		got, err := openTestImage(t, img).Decrypt(tt.key)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, body) {
+			t.Errorf("%s: decrypted body differs", tt.name)
+		}
+	}
+
+	img := encryptTestImage(t, body, aesKey, testTLV{ImageTLVEncKW, wrapped})
+	if _, err := openTestImage(t, img).Decrypt(make([]byte, 16)); err == nil {
+		t.Error("key unwrapped with the wrong kek")
+	}
+	tampered := bytes.Clone(xTLV)
+	tampered[len(tampered)-1] ^= 1
+	img = encryptTestImage(t, body, aesKey, testTLV{ImageTLVEncX25519, tampered})
+	if _, err := openTestImage(t, img).Decrypt(xPEM); err == nil {
+		t.Error("enc tlv with a bad hmac was accepted")
+	}
+	plain := buildTestImage(body, nil, []testTLV{{ImageTLVSHA256, make([]byte, 32)}})
+	if _, err := openTestImage(t, plain).Decrypt(kek); err == nil {
+		t.Error("unencrypted image was decrypted")
+	}
+}
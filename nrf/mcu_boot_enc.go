@@ -0,0 +1,214 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+const eciesInfo = "MCUBoot_ECIES_v1"
+
+// Decrypt unwraps the AES key from the ENC TLV with privKey and returns the
+// plaintext image body. privKey is a PEM private key, or a raw AES key for
+// images encrypted with AES-KW.
+func (b *MCUBoot) Decrypt(privKey []byte) ([]byte, error) {
+	if !b.header.IsEncrypted() {
+		return nil, errors.New("mcu-boot: image is not encrypted")
+	}
+	area, err := b.ReadTLVArea()
+	if err != nil {
+		return nil, err
+	}
+	key, err := b.unwrapKey(area, privKey)
+	if err != nil {
+		return nil, err
+	}
+	img, err := b.ExtractImage()
+	if err != nil {
+		return nil, err
+	}
+	return aesCTR(key, img)
+}
+
+func (b *MCUBoot) aesKeySize() int {
+	if b.header.Flags&imageFlags["EncryptedAes256"] != 0 {
+		return 32
+	}
+	return 16
+}
+
+func (b *MCUBoot) unwrapKey(area *TLVArea, privKey []byte) ([]byte, error) {
+	size := b.aesKeySize()
+	for _, tlv := range area.TLVs {
+		switch tlv.Type {
+		case ImageTLVEncRsa2048:
+			key, err := parsePrivateKey(privKey)
+			if err != nil {
+				return nil, err
+			}
+			pk, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return nil, errors.New("mcu-boot: rsa private key is required")
+			}
+			return rsa.DecryptOAEP(sha256.New(), nil, pk, tlv.Data, nil)
+		case ImageTLVEncKW:
+			return aesKeyUnwrap(privKey, tlv.Data)
+		case ImageTLVEncEC256:
+			key, err := parsePrivateKey(privKey)
+			if err != nil {
+				return nil, err
+			}
+			pk, ok := key.(*ecdsa.PrivateKey)
+			if !ok {
+				return nil, errors.New("mcu-boot: p256 private key is required")
+			}
+			priv, err := pk.ECDH()
+			if err != nil {
+				return nil, err
+			}
+			return eciesUnwrap(priv, tlv.Data, 65, size)
+		case ImageTLVEncX25519:
+			key, err := parsePrivateKey(privKey)
+			if err != nil {
+				return nil, err
+			}
+			priv, ok := key.(*ecdh.PrivateKey)
+			if !ok || priv.Curve() != ecdh.X25519() {
+				return nil, errors.New("mcu-boot: x25519 private key is required")
+			}
+			return eciesUnwrap(priv, tlv.Data, 32, size)
+		}
+	}
+	return nil, errors.New("mcu-boot: enc tlv not found")
+}
+
+// eciesUnwrap decodes an ENC TLV laid out as ephemeral public key, HMAC-SHA256
+// tag and the AES key encrypted with AES-CTR.
+func eciesUnwrap(priv *ecdh.PrivateKey, tlv []byte, pubSize, keySize int) ([]byte, error) {
+	if len(tlv) != pubSize+sha256.Size+keySize {
+		return nil, errors.New("mcu-boot: invalid enc tlv size")
+	}
+	pub, err := priv.Curve().NewPublicKey(tlv[:pubSize])
+	if err != nil {
+		return nil, err
+	}
+	secret, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	derived := hkdfSha256(secret, nil, []byte(eciesInfo), keySize+sha256.Size)
+	tag := tlv[pubSize : pubSize+sha256.Size]
+	encKey := tlv[pubSize+sha256.Size:]
+	mac := hmac.New(sha256.New, derived[keySize:])
+	mac.Write(encKey)
+	if !hmac.Equal(mac.Sum(nil), tag) {
+		return nil, errors.New("mcu-boot: enc tlv hmac mismatch")
+	}
+	return aesCTR(derived[:keySize], encKey)
+}
+
+// EncryptMCUBootImage is SignMCUBootImage with the body encrypted for
+// the recipient key set in opts.
+func EncryptMCUBootImage(img, privKey []byte, opts *ImageOptions) ([]byte, error) {
+	if opts == nil || !opts.encrypted() {
+		return nil, errors.New("mcu-boot: no encryption key")
+	}
+	return SignMCUBootImage(img, privKey, opts)
+}
+
+func wrapImageKey(opts *ImageOptions, aesKey []byte) (TLVType, []byte, error) {
+	if opts.KEK != nil {
+		enc, err := aesKeyWrap(opts.KEK, aesKey)
+		return ImageTLVEncKW, enc, err
+	}
+	key, err := parsePublicKey(opts.EncryptKey)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch pk := key.(type) {
+	case *rsa.PublicKey:
+		if pk.Size() != 256 {
+			return 0, nil, errors.New("mcu-boot: encryption requires an rsa-2048 key")
+		}
+		enc, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pk, aesKey, nil)
+		return ImageTLVEncRsa2048, enc, err
+	case *ecdsa.PublicKey:
+		pub, err := pk.ECDH()
+		if err != nil {
+			return 0, nil, err
+		}
+		if pub.Curve() != ecdh.P256() {
+			return 0, nil, errors.New("mcu-boot: unsupported ecies curve")
+		}
+		enc, err := eciesWrap(pub, aesKey)
+		return ImageTLVEncEC256, enc, err
+	case *ecdh.PublicKey:
+		if pk.Curve() != ecdh.X25519() {
+			return 0, nil, errors.New("mcu-boot: unsupported ecies curve")
+		}
+		enc, err := eciesWrap(pk, aesKey)
+		return ImageTLVEncX25519, enc, err
+	}
+	return 0, nil, fmt.Errorf("mcu-boot: unsupported encryption key %T", key)
+}
+
+// eciesWrap is the inverse of eciesUnwrap with a fresh ephemeral key.
+func eciesWrap(pub *ecdh.PublicKey, aesKey []byte) ([]byte, error) {
+	eph, err := pub.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := eph.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	size := len(aesKey)
+	derived := hkdfSha256(secret, nil, []byte(eciesInfo), size+sha256.Size)
+	encKey, err := aesCTR(derived[:size], aesKey)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, derived[size:])
+	mac.Write(encKey)
+	out := bytes.Clone(eph.PublicKey().Bytes())
+	out = mac.Sum(out)
+	return append(out, encKey...), nil
+}
+
+func parsePrivateKey(b []byte) (any, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("invalid pem block")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("unsupported pem block type %q", block.Type)
+}
+
+// aesCTR encrypts or decrypts b with a zero initial counter as MCUboot does.
+func aesCTR(key, b []byte) ([]byte, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(b))
+	iv := make([]byte, aes.BlockSize)
+	cipher.NewCTR(c, iv).XORKeyStream(out, b)
+	return out, nil
+}
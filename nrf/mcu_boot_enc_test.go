@@ -0,0 +1,148 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+func TestEncryptMCUBootImage(t *testing.T) {
+	signKey := privateKeyPEM(t, generateTestKey(t, "P-256"))
+	rsaKey := generateTestKey(t, "RSA-2048")
+	ecKey := generateTestKey(t, "P-256")
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek := make([]byte, 16)
+	if _, err := rand.Read(kek); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		opts    *ImageOptions
+		decrypt []byte
+		tlv     TLVType
+	}{
+		{"RSA-OAEP", &ImageOptions{EncryptKey: publicKeyPEM(t, rsaKey.Public())},
+			privateKeyPEM(t, rsaKey), ImageTLVEncRsa2048},
+		{"AES-KW", &ImageOptions{KEK: kek}, kek, ImageTLVEncKW},
+		{"ECIES-P256", &ImageOptions{EncryptKey: publicKeyPEM(t, ecKey.Public())},
+			privateKeyPEM(t, ecKey), ImageTLVEncEC256},
+		{"ECIES-P256-AES256", &ImageOptions{EncryptKey: publicKeyPEM(t, ecKey.Public()), AES256: true},
+			privateKeyPEM(t, ecKey), ImageTLVEncEC256},
+		{"X25519", &ImageOptions{EncryptKey: publicKeyPEM(t, x25519Key.Public())},
+			privateKeyPEM(t, x25519Key), ImageTLVEncX25519},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			enc, err := EncryptMCUBootImage(testImage, signKey, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := NewMCUBoot(bytes.NewReader(enc), int64(len(enc)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !b.Header().IsEncrypted() {
+				t.Fatal("header is not marked encrypted")
+			}
+			area, err := b.ReadTLVArea()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found bool
+			for _, tlv := range area.TLVs {
+				found = found || tlv.Type == tc.tlv
+			}
+			if !found {
+				t.Errorf("enc tlv 0x%02x not found", tc.tlv)
+			}
+			body, err := b.ExtractImage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(body, testImage) {
+				t.Fatal("image body is not encrypted")
+			}
+			plain, err := b.Decrypt(tc.decrypt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(plain, testImage) {
+				t.Error("decrypted image differs from the input")
+			}
+		})
+	}
+
+	// MCUboot only supports RSA-OAEP with 2048-bit keys.
+	rsa3072 := generateTestKey(t, "RSA-3072")
+	opts := &ImageOptions{EncryptKey: publicKeyPEM(t, rsa3072.Public())}
+	if _, err := EncryptMCUBootImage(testImage, signKey, opts); err == nil {
+		t.Error("image encrypted for an rsa-3072 key")
+	}
+}
+
+// Test vectors from RFC 3394 section 4.
+var aesKeyWrapTests = []struct {
+	kek, key, wrapped string
+}{
+	{
+		"000102030405060708090A0B0C0D0E0F",
+		"00112233445566778899AABBCCDDEEFF",
+		"1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5",
+	},
+	{
+		"000102030405060708090A0B0C0D0E0F1011121314151617",
+		"00112233445566778899AABBCCDDEEFF",
+		"96778B25AE6CA435F92B5B97C050AED2468AB8A17AD84E5D",
+	},
+	{
+		"000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+		"00112233445566778899AABBCCDDEEFF",
+		"64E8C3F9CE0F5BA263E9777905818A2A93C8191E7D6E8AE7",
+	},
+	{
+		"000102030405060708090A0B0C0D0E0F1011121314151617",
+		"00112233445566778899AABBCCDDEEFF0001020304050607",
+		"031D33264E15D33268F24EC260743EDCE1C6C7DDEE725A936BA814915C6762D2",
+	},
+	{
+		"000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+		"00112233445566778899AABBCCDDEEFF0001020304050607",
+		"A8F9BC1612C68B3FF6E6F4FBE30E71E4769C8B80A32CB8958CD5D17D6B254DA1",
+	},
+	{
+		"000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+		"00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F",
+		"28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21",
+	},
+}
+
+func TestAESKeyWrap(t *testing.T) {
+	for _, tc := range aesKeyWrapTests {
+		kek, _ := hex.DecodeString(tc.kek)
+		key, _ := hex.DecodeString(tc.key)
+		want, _ := hex.DecodeString(tc.wrapped)
+		got, err := aesKeyWrap(kek, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("aesKeyWrap(%s, %s) = %X, want %s", tc.kek, tc.key, got, tc.wrapped)
+		}
+		unwrapped, err := aesKeyUnwrap(kek, want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Errorf("aesKeyUnwrap(%s, %s) = %X, want %s", tc.kek, tc.wrapped, unwrapped, tc.key)
+		}
+		want[len(want)-1] ^= 1
+		if _, err := aesKeyUnwrap(kek, want); err == nil {
+			t.Errorf("aesKeyUnwrap(%s) accepted a modified key", tc.kek)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package nrf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MCUBootImage is an image found in a flash dump.
+type MCUBootImage struct {
+	*MCUBoot
+	// Offset of the image header in the dump.
+	Offset int64
+	// ImageID is the MCUboot image number, or UnknownImageID until
+	// PartitionMap.AssignImageIDs finds the slot the image is stored in.
+	ImageID         int
+	SecurityCounter *uint32
+	Dependencies    []ImageDependency
+	// Unmet lists the dependencies not satisfied by any other image.
+	Unmet []ImageDependency
+}
+
+// UnknownImageID is the ImageID of an image outside any known slot.
+const UnknownImageID = -1
+
+// Version returns the image version from the header.
+func (m *MCUBootImage) Version() ImgVersion {
+	return m.header.Ver
+}
+
+// MCUBootImages are the images found in one file. They share the file,
+// which stays open until Close is called.
+type MCUBootImages struct {
+	Images []*MCUBootImage
+	closer io.Closer
+}
+
+// Close releases the file opened by DetectMCUBootImages. The images must
+// not be used afterwards.
+func (m *MCUBootImages) Close() error {
+	if m.closer == nil {
+		return nil
+	}
+	return m.closer.Close()
+}
+
+// DetectMCUBootImages opens the file and finds every MCUboot image in it.
+// The caller owns the returned set and must Close it.
+func DetectMCUBootImages(name string) (*MCUBootImages, error) {
+	f, err := openImage(name)
+	if err != nil {
+		return nil, err
+	}
+	images, err := FindMCUBootImages(f.r, f.size)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	for _, img := range images {
+		img.symbols = f.symbols
+	}
+	return &MCUBootImages{Images: images, closer: f}, nil
+}
+
+// FindMCUBootImages finds every image header confirmed by its TLV area in
+// the first size bytes of r. Image numbers depend on the slot layout, so
+// dependencies are checked by PartitionMap.AssignImageIDs, or by
+// CheckDependencies once ImageID is set.
+func FindMCUBootImages(r io.ReaderAt, size int64) ([]*MCUBootImage, error) {
+	offsets, err := findMCUBootImageMagic(r, size)
+	if err != nil {
+		return nil, err
+	}
+	var images []*MCUBootImage
+	var end int64
+	for _, off := range offsets {
+		// Skip magic values inside the previous image.
+		if off < end {
+			continue
+		}
+		header, err := readMCUBootImgHeader(r, off, size)
+		if err != nil {
+			continue
+		}
+		img, err := newMCUBootImage(&MCUBoot{r: r, base: off, header: header})
+		if err != nil {
+			continue
+		}
+		if end, err = img.end(); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+func newMCUBootImage(b *MCUBoot) (*MCUBootImage, error) {
+	tlvs, err := b.TLVs()
+	if err != nil {
+		return nil, err
+	}
+	img := &MCUBootImage{MCUBoot: b, Offset: b.base, ImageID: UnknownImageID}
+	for _, tlv := range tlvs {
+		switch tlv.Type {
+		case ImageTLVEncSecCnt:
+			if len(tlv.Data) == 4 {
+				cnt := binary.LittleEndian.Uint32(tlv.Data)
+				img.SecurityCounter = &cnt
+			}
+		case ImageTLVEncDependency:
+			var dep ImageDependency
+			if err := binary.Read(bytes.NewReader(tlv.Data), binary.LittleEndian, &dep); err != nil {
+				return nil, err
+			}
+			img.Dependencies = append(img.Dependencies, dep)
+		}
+	}
+	return img, nil
+}
+
+// CheckDependencies sets Unmet of every image. A dependency is met when an
+// image with the same ImageID has at least the required version. An image
+// with dependencies but an UnknownImageID is an error, since the image it
+// depends on may be itself.
+func CheckDependencies(images []*MCUBootImage) error {
+	for _, img := range images {
+		img.Unmet = nil
+		if img.ImageID == UnknownImageID && len(img.Dependencies) != 0 {
+			return fmt.Errorf("mcu-boot: image at 0x%x has dependencies but no image id", img.Offset)
+		}
+	}
+	for _, img := range images {
+		for _, dep := range img.Dependencies {
+			if !dependencyMet(images, dep) {
+				img.Unmet = append(img.Unmet, dep)
+			}
+		}
+	}
+	return nil
+}
+
+func dependencyMet(images []*MCUBootImage, dep ImageDependency) bool {
+	for _, img := range images {
+		if img.ImageID != int(dep.ImageID) {
+			continue
+		}
+		if compareImgVersion(img.Version(), dep.MinVersion) >= 0 {
+			return true
+		}
+	}
+	return false
+}
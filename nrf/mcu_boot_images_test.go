@@ -0,0 +1,67 @@
+package nrf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func dependencyTLV(id uint8, ver ImgVersion) testTLV {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, ImageDependency{ImageID: id, MinVersion: ver})
+	return testTLV{ImageTLVEncDependency, buf.Bytes()}
+}
+
+func TestCheckDependencies(t *testing.T) {
+	hash := testTLV{ImageTLVSHA256, make([]byte, 32)}
+	// The application needs network core image 1.3.0, but 1.2.3 is stored.
+	app := buildTestImage(bytes.Repeat([]byte{0x11}, 0x100),
+		[]testTLV{dependencyTLV(1, ImgVersion{Major: 1, Minor: 3})}, []testTLV{hash})
+	net := buildTestImage(bytes.Repeat([]byte{0x22}, 0x100),
+		[]testTLV{dependencyTLV(0, ImgVersion{Major: 1})}, []testTLV{hash})
+	dump := bytes.Repeat([]byte{0xff}, 0x20000)
+	copy(dump[0xc000:], app)
+	copy(dump[0x14000:], net)
+
+	images, err := FindMCUBootImages(bytes.NewReader(dump), int64(len(dump)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("found %d images, want 2", len(images))
+	}
+	if err := CheckDependencies(images); err == nil {
+		t.Error("dependencies checked without image ids")
+	}
+
+	m, err := LoadPartitionManager(strings.NewReader(`
+mcuboot:
+  address: 0x0
+  size: 0xc000
+  region: flash_primary
+mcuboot_primary:
+  address: 0xc000
+  size: 0x8000
+  region: flash_primary
+mcuboot_primary_1:
+  address: 0x14000
+  size: 0x8000
+  region: flash_primary
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AssignImageIDs(images); err != nil {
+		t.Fatal(err)
+	}
+	if images[0].ImageID != 0 || images[1].ImageID != 1 {
+		t.Fatalf("image ids = %d, %d", images[0].ImageID, images[1].ImageID)
+	}
+	if len(images[0].Unmet) != 1 || images[0].Unmet[0].ImageID != 1 {
+		t.Errorf("unmet dependencies of image 0 = %+v", images[0].Unmet)
+	}
+	if len(images[1].Unmet) != 0 {
+		t.Errorf("unmet dependencies of image 1 = %+v", images[1].Unmet)
+	}
+}
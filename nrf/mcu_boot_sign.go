@@ -0,0 +1,230 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	mcuBootMagic          = 0x96f3b83d
+	defaultMCUBootHdrSize = 0x200
+)
+
+// ImageDependency is the payload of an ImageTLVEncDependency TLV.
+type ImageDependency struct {
+	ImageID    uint8
+	Pad1       uint8
+	Pad2       uint16
+	MinVersion ImgVersion
+}
+
+// ImageOptions are the parameters of a new MCUboot image, matching the
+// arguments of imgtool sign.
+type ImageOptions struct {
+	LoadAddr uint32
+	Version  ImgVersion
+	Flags    uint32
+	// HeaderSize defaults to 0x200. The header is padded with 0xFF.
+	HeaderSize uint16
+	// SecurityCounter adds a protected security counter TLV when set.
+	SecurityCounter *uint32
+	Dependencies    []ImageDependency
+	// PublicKey stores the full public key instead of its hash.
+	PublicKey bool
+	// EncryptKey is the PEM or DER public key (RSA, P-256 or X25519) of the
+	// recipient. The image body is encrypted when it or KEK is set.
+	EncryptKey []byte
+	// KEK is an AES key that wraps the image key with AES-KW.
+	KEK []byte
+	// AES256 encrypts with AES-256 instead of AES-128.
+	AES256 bool
+}
+
+func (o *ImageOptions) encrypted() bool {
+	return o.EncryptKey != nil || o.KEK != nil
+}
+
+// SignMCUBootImage prepends an image header to img and appends a TLV area
+// signed with the PEM private key.
+func SignMCUBootImage(img, privKey []byte, opts *ImageOptions) ([]byte, error) {
+	key, err := parsePrivateKey(privKey)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("mcu-boot: unsupported private key %T", key)
+	}
+	return buildMCUBootImage(img, signer, opts)
+}
+
+func buildMCUBootImage(img []byte, signer crypto.Signer, opts *ImageOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &ImageOptions{}
+	}
+	hdrSize := opts.HeaderSize
+	if hdrSize == 0 {
+		hdrSize = defaultMCUBootHdrSize
+	}
+	if hdrSize < 0x20 {
+		return nil, errors.New("mcu-boot: header size is too small")
+	}
+	sigType, hashType, err := mcuBootSigType(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	prot := opts.protectedTLVs()
+	var protSize uint16
+	if len(prot) > 0 {
+		protSize = uint16(4 + len(prot))
+	}
+	header := MCUBootImgHeader{
+		Magic:            mcuBootMagic,
+		LoadAddr:         opts.LoadAddr,
+		Size:             hdrSize,
+		ProtectedTLVSize: protSize,
+		ImgSize:          uint32(len(img)),
+		Flags:            opts.Flags,
+		Ver:              opts.Version,
+	}
+	var aesKey []byte
+	if opts.encrypted() {
+		header.Flags &^= imageFlags["EncryptedAes128"] | imageFlags["EncryptedAes256"]
+		if opts.AES256 {
+			aesKey = make([]byte, 32)
+			header.Flags |= imageFlags["EncryptedAes256"]
+		} else {
+			aesKey = make([]byte, 16)
+			header.Flags |= imageFlags["EncryptedAes128"]
+		}
+		if _, err := rand.Read(aesKey); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	buf.Write(bytes.Repeat([]byte{0xFF}, int(hdrSize)-buf.Len()))
+	buf.Write(img)
+	if protSize != 0 {
+		writeTLVInfo(&buf, imageTLVProtInfoMagic, protSize)
+		buf.Write(prot)
+	}
+	digest := sumWith(hashType, buf.Bytes())
+
+	der, err := marshalMCUBootKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	var tlvs bytes.Buffer
+	writeTLV(&tlvs, hashType, digest)
+	if opts.PublicKey {
+		writeTLV(&tlvs, ImageTLVPubKey, der)
+	} else {
+		writeTLV(&tlvs, ImageTLVKeyHash, sumWith(hashType, der))
+	}
+	sig, err := signMCUBootDigest(signer, hashType, digest)
+	if err != nil {
+		return nil, err
+	}
+	writeTLV(&tlvs, sigType, sig)
+	if aesKey != nil {
+		// The hash and signature cover the plaintext body.
+		encType, enc, err := wrapImageKey(opts, aesKey)
+		if err != nil {
+			return nil, err
+		}
+		writeTLV(&tlvs, encType, enc)
+		body := buf.Bytes()[hdrSize : int(hdrSize)+len(img)]
+		ct, err := aesCTR(aesKey, body)
+		if err != nil {
+			return nil, err
+		}
+		copy(body, ct)
+	}
+
+	writeTLVInfo(&buf, imageTLVInfoMagic, uint16(4+tlvs.Len()))
+	buf.Write(tlvs.Bytes())
+	return buf.Bytes(), nil
+}
+
+func (o *ImageOptions) protectedTLVs() []byte {
+	var buf bytes.Buffer
+	if o.SecurityCounter != nil {
+		b := binary.LittleEndian.AppendUint32(nil, *o.SecurityCounter)
+		writeTLV(&buf, ImageTLVEncSecCnt, b)
+	}
+	for _, dep := range o.Dependencies {
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, &dep)
+		writeTLV(&buf, ImageTLVEncDependency, b.Bytes())
+	}
+	return buf.Bytes()
+}
+
+func writeTLVInfo(buf *bytes.Buffer, magic, size uint16) {
+	binary.Write(buf, binary.LittleEndian, &ImageTLVInfo{Magic: magic, TotalSize: size})
+}
+
+func writeTLV(buf *bytes.Buffer, t TLVType, data []byte) {
+	tlv := ImageTLV{ItType: uint8(t), ItSize: uint16(len(data))}
+	binary.Write(buf, binary.LittleEndian, &tlv)
+	buf.Write(data)
+}
+
+// mcuBootSigType returns the signature and hash TLV types used by imgtool
+// for the key.
+func mcuBootSigType(key crypto.PublicKey) (TLVType, TLVType, error) {
+	switch pk := key.(type) {
+	case *rsa.PublicKey:
+		switch pk.N.BitLen() {
+		case 2048:
+			return ImageTLVRsa2048PSS, ImageTLVSHA256, nil
+		case 3072:
+			return ImageTLVRsa3072PSS, ImageTLVSHA256, nil
+		}
+		return 0, 0, errors.New("mcu-boot: unsupported rsa key size")
+	case *ecdsa.PublicKey:
+		switch pk.Curve {
+		case elliptic.P256():
+			return ImageTLVEcdsaSig, ImageTLVSHA256, nil
+		case elliptic.P384():
+			return ImageTLVEcdsaSig, ImageTLVSHA384, nil
+		}
+		return 0, 0, errors.New("mcu-boot: unsupported ecdsa curve")
+	case ed25519.PublicKey:
+		return ImageTLVED25519, ImageTLVSHA256, nil
+	}
+	return 0, 0, fmt.Errorf("mcu-boot: unsupported key type %T", key)
+}
+
+func signMCUBootDigest(signer crypto.Signer, hashType TLVType, digest []byte) ([]byte, error) {
+	var opts crypto.SignerOpts = hashFunc(hashType)
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hashFunc(hashType)}
+	case ed25519.PublicKey:
+		// imgtool signs the digest as an Ed25519 message.
+		opts = crypto.Hash(0)
+	}
+	return signer.Sign(rand.Reader, digest, opts)
+}
+
+func sumWith(t TLVType, b []byte) []byte {
+	h, err := newImageHash(t)
+	if err != nil {
+		h = sha256.New()
+	}
+	h.Write(b)
+	return h.Sum(nil)
+}
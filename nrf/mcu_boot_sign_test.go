@@ -0,0 +1,42 @@
+package nrf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSignMCUBootImage(t *testing.T) {
+	for _, name := range []string{"P-256", "P-384", "Ed25519", "RSA-2048", "RSA-3072"} {
+		t.Run(name, func(t *testing.T) {
+			key := generateTestKey(t, name)
+			opts := &ImageOptions{
+				LoadAddr: 0x10000,
+				Version:  ImgVersion{Major: 1, Minor: 2, Revision: 3, BuildNum: 4},
+			}
+			signed, err := SignMCUBootImage(testImage, privateKeyPEM(t, key), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := verifySigned(t, signed, key.Public())
+			if b.Header().Ver != opts.Version {
+				t.Errorf("version = %v, want %v", b.Header().Ver, opts.Version)
+			}
+			img, err := b.ExtractImage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(img, testImage) {
+				t.Error("image body differs from the input")
+			}
+
+			other := generateTestKey(t, name)
+			if err := b.Verify(publicKeyPEM(t, other.Public())); err == nil {
+				t.Error("verified with the wrong key")
+			}
+			signed[0x200+0x10] ^= 0xff
+			if err := b.Verify(publicKeyPEM(t, key.Public())); err == nil {
+				t.Error("verified a modified image")
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package nrf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	imageTLVInfoMagic     = 0x6907
+	imageTLVProtInfoMagic = 0x6908
+)
+
+// TLV is an entry of the protected or unprotected TLV area.
+type TLV struct {
+	ImageTLV
+	Type TLVType
+	// Offset of the payload from the start of the image header.
+	Offset    int64
+	Protected bool
+	Data      []byte
+}
+
+// TLVIterator walks the protected and unprotected TLV areas of an image.
+type TLVIterator struct {
+	r         io.ReaderAt
+	base      int64
+	offset    int64
+	end       int64
+	protected bool
+	// start of the unprotected area, or -1 once it has been entered
+	next int64
+}
+
+// TLVIterator returns an iterator positioned at the first TLV after the
+// image body.
+func (b *MCUBoot) TLVIterator() (*TLVIterator, error) {
+	offset := b.base + int64(b.header.Size) + int64(b.header.ImgSize)
+	it := &TLVIterator{r: b.r, base: b.base, next: -1}
+	if b.header.ProtectedTLVSize != 0 {
+		info, err := it.readInfo(offset)
+		if err != nil {
+			return nil, err
+		}
+		if info.Magic != imageTLVProtInfoMagic || info.TotalSize != b.header.ProtectedTLVSize {
+			return nil, errors.New("mcu-boot: invalid protected tlv info")
+		}
+		it.protected = true
+		it.next = offset + int64(info.TotalSize)
+		it.offset = offset + 4
+		it.end = it.next
+		return it, nil
+	}
+	if err := it.enterUnprotected(offset); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+func (it *TLVIterator) readInfo(off int64) (*ImageTLVInfo, error) {
+	b := make([]byte, 4)
+	if _, err := it.r.ReadAt(b, off); err != nil {
+		return nil, err
+	}
+	var info ImageTLVInfo
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &info); err != nil {
+		return nil, err
+	}
+	if info.Magic != imageTLVInfoMagic && info.Magic != imageTLVProtInfoMagic {
+		return nil, errors.New("mcu-boot: invalid tlv image magic")
+	}
+	if info.TotalSize < 4 {
+		return nil, errors.New("mcu-boot: invalid tlv area size")
+	}
+	return &info, nil
+}
+
+func (it *TLVIterator) enterUnprotected(off int64) error {
+	info, err := it.readInfo(off)
+	if err != nil {
+		return err
+	}
+	if info.Magic != imageTLVInfoMagic {
+		return errors.New("mcu-boot: invalid tlv image magic")
+	}
+	it.protected = false
+	it.next = -1
+	it.offset = off + 4
+	it.end = off + int64(info.TotalSize)
+	return nil
+}
+
+// Next returns the next TLV. It returns io.EOF after the last TLV of the
+// unprotected area.
+func (it *TLVIterator) Next() (*TLV, error) {
+	for it.offset >= it.end {
+		if it.next == -1 {
+			return nil, io.EOF
+		}
+		if err := it.enterUnprotected(it.next); err != nil {
+			return nil, err
+		}
+	}
+	if it.offset+4 > it.end {
+		return nil, errors.New("mcu-boot: truncated tlv")
+	}
+	h := make([]byte, 4)
+	if _, err := it.r.ReadAt(h, it.offset); err != nil {
+		return nil, err
+	}
+	var hdr ImageTLV
+	if err := binary.Read(bytes.NewReader(h), binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	start := it.offset + 4
+	if start+int64(hdr.ItSize) > it.end {
+		return nil, errors.New("mcu-boot: truncated tlv")
+	}
+	data := make([]byte, hdr.ItSize)
+	if _, err := it.r.ReadAt(data, start); err != nil {
+		return nil, err
+	}
+	it.offset = start + int64(hdr.ItSize)
+	tlv := &TLV{
+		ImageTLV:  hdr,
+		Type:      TLVType(hdr.ItType),
+		Offset:    start - it.base,
+		Protected: it.protected,
+		Data:      data,
+	}
+	return tlv, nil
+}
+
+// end returns the offset in r just past the TLV area.
+func (b *MCUBoot) end() (int64, error) {
+	it, err := b.TLVIterator()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		if _, err := it.Next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return it.end, nil
+			}
+			return 0, err
+		}
+	}
+}
+
+// Raw returns the complete image: header, body and TLV areas.
+func (b *MCUBoot) Raw() ([]byte, error) {
+	end, err := b.end()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, end-b.base)
+	if _, err := b.r.ReadAt(out, b.base); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TLVs returns every TLV of the image in the order they are stored.
+func (b *MCUBoot) TLVs() ([]*TLV, error) {
+	it, err := b.TLVIterator()
+	if err != nil {
+		return nil, err
+	}
+	var tlvs []*TLV
+	for {
+		tlv, err := it.Next()
+		if errors.Is(err, io.EOF) {
+			return tlvs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		tlvs = append(tlvs, tlv)
+	}
+}
+
+type TLVArea struct {
+	ImageHash []byte
+	// ImageTLVSHA256, ImageTLVSHA384 or ImageTLVSHA512
+	HashType  TLVType
+	KeyHash   []byte
+	PublicKey []byte
+	Signature []byte
+	SigType   TLVType
+	// Pure is set when the signature covers the image instead of its hash.
+	Pure bool
+	TLVs []*TLV
+}
+
+// ReadTLVArea reads every TLV of the image, regardless of their order.
+func (b *MCUBoot) ReadTLVArea() (*TLVArea, error) {
+	tlvs, err := b.TLVs()
+	if err != nil {
+		return nil, err
+	}
+	area := &TLVArea{TLVs: tlvs}
+	for _, tlv := range tlvs {
+		switch tlv.Type {
+		case ImageTLVSHA256, ImageTLVSHA384, ImageTLVSHA512:
+			area.ImageHash = tlv.Data
+			area.HashType = tlv.Type
+		case ImageTLVKeyHash:
+			area.KeyHash = tlv.Data
+		case ImageTLVPubKey:
+			area.PublicKey = tlv.Data
+		case ImageTLVRsa2048PSS, ImageTLVEcdsa224, ImageTLVEcdsaSig, ImageTLVRsa3072PSS, ImageTLVED25519:
+			area.Signature = tlv.Data
+			area.SigType = tlv.Type
+		case ImageTLVSigPure:
+			area.Pure = true
+		}
+	}
+	if area.ImageHash == nil && !area.Pure {
+		return nil, errors.New("mcu-boot: invalid tlv hash")
+	}
+	return area, nil
+}
+
+// Find returns the first TLV of the given type.
+func (a *TLVArea) Find(t TLVType) (*TLV, bool) {
+	for _, tlv := range a.TLVs {
+		if tlv.Type == t {
+			return tlv, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,116 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+)
+
+type testTLV struct {
+	typ  TLVType
+	data []byte
+}
+
+func writeTestTLVArea(buf *bytes.Buffer, magic uint16, tlvs []testTLV) {
+	size := 4
+	for _, tlv := range tlvs {
+		size += 4 + len(tlv.data)
+	}
+	binary.Write(buf, binary.LittleEndian, [2]uint16{magic, uint16(size)})
+	for _, tlv := range tlvs {
+		binary.Write(buf, binary.LittleEndian, [2]uint16{uint16(tlv.typ), uint16(len(tlv.data))})
+		buf.Write(tlv.data)
+	}
+}
+
+// buildTestImage lays out an MCUboot image by hand, without the signer.
+func buildTestImage(body []byte, protected, unprotected []testTLV) []byte {
+	var prot bytes.Buffer
+	if len(protected) != 0 {
+		writeTestTLVArea(&prot, imageTLVProtInfoMagic, protected)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, MCUBootImgHeader{
+		Magic:            mcuBootMagic,
+		Size:             0x20,
+		ProtectedTLVSize: uint16(prot.Len()),
+		ImgSize:          uint32(len(body)),
+		Ver:              ImgVersion{Major: 1, Minor: 2, Revision: 3},
+	})
+	buf.Write(body)
+	buf.Write(prot.Bytes())
+	writeTestTLVArea(&buf, imageTLVInfoMagic, unprotected)
+	return buf.Bytes()
+}
+
+func TestTLVIterator(t *testing.T) {
+	body := bytes.Repeat([]byte{0x5a}, 0x40)
+	counter := []byte{7, 0, 0, 0}
+	hash := sha256.Sum256(body)
+	sig := bytes.Repeat([]byte{0x01}, 0x40)
+	img := buildTestImage(body,
+		[]testTLV{{ImageTLVEncSecCnt, counter}},
+		[]testTLV{{ImageTLVSHA256, hash[:]}, {ImageTLVEcdsaSig, sig}})
+	// Trailing erased flash is not part of the image.
+	dump := append(bytes.Repeat([]byte{0xff}, 0x100), img...)
+	dump = append(dump, bytes.Repeat([]byte{0xff}, 0x100)...)
+
+	b, err := NewMCUBoot(bytes.NewReader(dump), int64(len(dump)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlvs, err := b.TLVs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		typ       TLVType
+		protected bool
+		offset    int64
+		data      []byte
+	}{
+		{ImageTLVEncSecCnt, true, 0x20 + 0x40 + 8, counter},
+		{ImageTLVSHA256, false, 0x20 + 0x40 + 12 + 8, hash[:]},
+		{ImageTLVEcdsaSig, false, 0x20 + 0x40 + 12 + 8 + 32 + 4, sig},
+	}
+	if len(tlvs) != len(want) {
+		t.Fatalf("got %d tlvs, want %d", len(tlvs), len(want))
+	}
+	for i, w := range want {
+		tlv := tlvs[i]
+		if tlv.Type != w.typ || tlv.Protected != w.protected || tlv.Offset != w.offset || !bytes.Equal(tlv.Data, w.data) {
+			t.Errorf("tlv %d = {%#x %v %#x}, want {%#x %v %#x}",
+				i, tlv.Type, tlv.Protected, tlv.Offset, w.typ, w.protected, w.offset)
+		}
+	}
+
+	raw, err := b.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, img) {
+		t.Errorf("Raw() returned %d bytes, want %d", len(raw), len(img))
+	}
+
+	area, err := b.ReadTLVArea()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if area.HashType != ImageTLVSHA256 || !bytes.Equal(area.ImageHash, hash[:]) || area.SigType != ImageTLVEcdsaSig {
+		t.Errorf("ReadTLVArea() = %+v", area)
+	}
+}
+
+func TestTLVIteratorTruncated(t *testing.T) {
+	img := buildTestImage([]byte{1, 2, 3, 4}, nil, []testTLV{{ImageTLVSHA256, make([]byte, 32)}})
+	// Claim a TLV longer than the area.
+	binary.LittleEndian.PutUint16(img[0x20+4+4+2:], 0x40)
+	b, err := NewMCUBoot(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.TLVs(); err == nil {
+		t.Error("truncated tlv was accepted")
+	}
+}
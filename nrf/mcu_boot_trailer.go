@@ -0,0 +1,284 @@
+package nrf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	bootMagicSize        = 16
+	bootMaxAlign         = 8
+	bootStatusMaxEntries = 128
+	// flash write block size of nRF52 and nRF53 devices
+	bootWriteSize = 4
+
+	bootFlagSet = 0x01
+	bootErased  = 0xFF
+)
+
+var bootImgMagic = []byte{
+	0x77, 0xc2, 0x95, 0xf3, 0x60, 0xd2, 0xef, 0x7f,
+	0x35, 0x52, 0x50, 0x0f, 0x2c, 0xb6, 0x79, 0x80,
+}
+
+// TrailerState is the decoded state of a trailer magic or flag.
+type TrailerState uint8
+
+const (
+	TrailerGood TrailerState = iota + 1 // magic is valid or flag is set
+	TrailerUnset
+	TrailerBad
+)
+
+func (s TrailerState) String() string {
+	switch s {
+	case TrailerGood:
+		return "good"
+	case TrailerUnset:
+		return "unset"
+	case TrailerBad:
+		return "bad"
+	}
+	return "unknown"
+}
+
+type SwapType uint8
+
+const (
+	SwapTypeNone   SwapType = 0x01 // no swap
+	SwapTypeTest   SwapType = 0x02 // swap, revert on next boot unless confirmed
+	SwapTypePerm   SwapType = 0x03 // swap permanently
+	SwapTypeRevert SwapType = 0x04 // swap back to the previous image
+	SwapTypeFail   SwapType = 0x05
+	SwapTypePanic  SwapType = 0xff
+)
+
+func (t SwapType) String() string {
+	switch t {
+	case SwapTypeNone:
+		return "none"
+	case SwapTypeTest:
+		return "test"
+	case SwapTypePerm:
+		return "perm"
+	case SwapTypeRevert:
+		return "revert"
+	case SwapTypeFail:
+		return "fail"
+	case SwapTypePanic:
+		return "panic"
+	}
+	return "unknown"
+}
+
+// SwapMode is the MCUboot upgrade strategy that writes the trailer.
+type SwapMode uint8
+
+const (
+	SwapModeScratch SwapMode = iota // CONFIG_BOOT_SWAP_USING_SCRATCH
+	SwapModeMove                    // CONFIG_BOOT_SWAP_USING_MOVE
+	SwapModeOffset                  // CONFIG_BOOT_SWAP_USING_OFFSET
+)
+
+// TrailerOptions is the bootloader configuration that determines the trailer
+// layout. A nil *TrailerOptions is a swap-scratch trailer without key slots.
+type TrailerOptions struct {
+	Mode SwapMode
+	// MaxAlign is BOOT_MAX_ALIGN; 8 if zero.
+	MaxAlign int
+	// EncKeySize is the size of an encryption key slot before padding to
+	// MaxAlign: the AES key size, or the ENC TLV size with
+	// CONFIG_BOOT_SWAP_SAVE_ENCTLV. Zero without CONFIG_BOOT_ENCRYPT_IMAGE.
+	EncKeySize int
+}
+
+func (o *TrailerOptions) maxAlign() int {
+	if o == nil || o.MaxAlign == 0 {
+		return bootMaxAlign
+	}
+	return o.MaxAlign
+}
+
+func (o *TrailerOptions) encKeySize() int {
+	if o == nil {
+		return 0
+	}
+	return o.EncKeySize
+}
+
+// statusStateCount is the number of status writes per swapped sector.
+func (o *TrailerOptions) statusStateCount() int {
+	if o == nil || o.Mode == SwapModeScratch {
+		return 3
+	}
+	return 2
+}
+
+// infoSize is the size of swap_size, swap_info, copy_done, image_ok and
+// the magic, each padded to MaxAlign.
+func (o *TrailerOptions) infoSize() int64 {
+	align := o.maxAlign()
+	return int64(alignUp(bootMagicSize, align) + 4*align)
+}
+
+// ImageTrailer is the MCUboot trailer at the end of an image slot.
+type ImageTrailer struct {
+	Magic    TrailerState
+	ImageOK  TrailerState
+	CopyDone TrailerState
+	// SwapType and ImageNum are decoded from swap_info.
+	SwapType SwapType
+	ImageNum uint8
+	SwapSize uint32
+	// EncKeys are the key slots of an encrypted swap, wrapped with the
+	// bootloader's key, or nil when opts has no key slots.
+	EncKeys [][]byte
+	// Status holds the first byte of every swap status entry.
+	Status []byte
+}
+
+// ReadImageTrailer decodes the trailer at the end of a slot of slotSize
+// bytes laid out as described by opts. r starts at the beginning of the
+// slot. The two key slots sit between swap_size and the swap status.
+func ReadImageTrailer(r io.ReaderAt, slotSize int64, opts *TrailerOptions) (*ImageTrailer, error) {
+	align := opts.maxAlign()
+	if align < bootWriteSize || align&(align-1) != 0 {
+		return nil, errors.New("mcu-boot: invalid trailer alignment")
+	}
+	encKeySize := opts.encKeySize()
+	keySlot := int64(alignUp(encKeySize, align))
+	infoSize := opts.infoSize()
+	statusSize := int64(bootStatusMaxEntries * opts.statusStateCount() * bootWriteSize)
+	if slotSize < infoSize+2*keySlot+statusSize {
+		return nil, errors.New("mcu-boot: slot is too small for a trailer")
+	}
+	info := make([]byte, infoSize)
+	if _, err := r.ReadAt(info, slotSize-infoSize); err != nil {
+		return nil, err
+	}
+	keys := make([]byte, 2*keySlot)
+	if _, err := r.ReadAt(keys, slotSize-infoSize-2*keySlot); err != nil {
+		return nil, err
+	}
+	status := make([]byte, statusSize)
+	if _, err := r.ReadAt(status, slotSize-infoSize-2*keySlot-statusSize); err != nil {
+		return nil, err
+	}
+	magic := info[len(info)-bootMagicSize:]
+	swapInfo := info[align]
+	t := &ImageTrailer{
+		Magic:    decodeTrailerMagic(magic),
+		ImageOK:  decodeTrailerFlag(info[3*align]),
+		CopyDone: decodeTrailerFlag(info[2*align]),
+		SwapType: SwapTypeNone,
+	}
+	if swapInfo != bootErased {
+		t.SwapType = SwapType(swapInfo & 0x0F)
+		t.ImageNum = swapInfo >> 4
+		if t.SwapType < SwapTypeTest || t.SwapType > SwapTypeRevert {
+			t.SwapType = SwapTypeNone
+		}
+	}
+	if size := binary.LittleEndian.Uint32(info); size != 0xFFFFFFFF {
+		t.SwapSize = size
+	}
+	// slot 0 is closest to swap_size
+	for off := len(keys) - int(keySlot); off >= 0 && keySlot > 0; off -= int(keySlot) {
+		t.EncKeys = append(t.EncKeys, keys[off:off+encKeySize])
+	}
+	for i := 0; i < len(status); i += bootWriteSize {
+		t.Status = append(t.Status, status[i])
+	}
+	return t, nil
+}
+
+// ReadTrailer decodes the trailer of the slot starting at the image header.
+func (b *MCUBoot) ReadTrailer(slotSize int64, opts *TrailerOptions) (*ImageTrailer, error) {
+	r := io.NewSectionReader(b.r, b.base, slotSize)
+	return ReadImageTrailer(r, slotSize, opts)
+}
+func decodeTrailerMagic(b []byte) TrailerState {
+	if bytes.Equal(b, bootImgMagic) {
+		return TrailerGood
+	}
+	if bytes.Equal(b, bytes.Repeat([]byte{bootErased}, bootMagicSize)) {
+		return TrailerUnset
+	}
+	return TrailerBad
+}
+
+func decodeTrailerFlag(b byte) TrailerState {
+	switch b {
+	case bootErased:
+		return TrailerUnset
+	case bootFlagSet:
+		return TrailerGood
+	}
+	return TrailerBad
+}
+
+// StatusCount returns the number of written swap status entries.
+func (t *ImageTrailer) StatusCount() int {
+	var n int
+	for _, v := range t.Status {
+		if v != bootErased {
+			n++
+		}
+	}
+	return n
+}
+
+// BootSwapType returns the swap type MCUboot derives from the trailers of
+// the primary and secondary slots.
+func BootSwapType(primary, secondary *ImageTrailer) SwapType {
+	if secondary.Magic == TrailerGood {
+		switch secondary.ImageOK {
+		case TrailerUnset:
+			return SwapTypeTest
+		case TrailerGood:
+			return SwapTypePerm
+		}
+	}
+	if primary.Magic == TrailerGood && secondary.Magic == TrailerUnset &&
+		primary.ImageOK == TrailerUnset && primary.CopyDone == TrailerGood {
+		return SwapTypeRevert
+	}
+	return SwapTypeNone
+}
+
+// SetPending writes the trailer of a secondary slot so MCUboot swaps to it
+// on the next boot. The image is kept only if permanent is set or it is
+// confirmed after the swap.
+func SetPending(w io.WriterAt, slotSize int64, permanent bool, opts *TrailerOptions) error {
+	off := slotSize - opts.infoSize()
+	align := int64(opts.maxAlign())
+	swapType := SwapTypeTest
+	if permanent {
+		if _, err := w.WriteAt([]byte{bootFlagSet}, off+3*align); err != nil {
+			return err
+		}
+		swapType = SwapTypePerm
+	}
+	if _, err := w.WriteAt([]byte{byte(swapType)}, off+align); err != nil {
+		return err
+	}
+	_, err := w.WriteAt(bootImgMagic, slotSize-bootMagicSize)
+	return err
+}
+
+// SetConfirmed sets image_ok in the trailer of a primary slot so MCUboot
+// does not revert the running image.
+func SetConfirmed(w io.WriterAt, slotSize int64, opts *TrailerOptions) error {
+	off := slotSize - opts.infoSize()
+	if _, err := w.WriteAt([]byte{bootFlagSet}, off+3*int64(opts.maxAlign())); err != nil {
+		return err
+	}
+	_, err := w.WriteAt(bootImgMagic, slotSize-bootMagicSize)
+	return err
+}
+
+func alignUp(n, align int) int {
+	return (n + align - 1) / align * align
+}
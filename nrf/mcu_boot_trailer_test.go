@@ -0,0 +1,121 @@
+package nrf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+type slotBuffer []byte
+
+func (s slotBuffer) WriteAt(p []byte, off int64) (int, error) {
+	return copy(s[off:], p), nil
+}
+
+func TestReadImageTrailer(t *testing.T) {
+	const slotSize = 0x4000
+	key0 := bytes.Repeat([]byte{0xa0}, 32)
+	key1 := bytes.Repeat([]byte{0xa1}, 32)
+	tests := []struct {
+		name string
+		opts *TrailerOptions
+		// offsets from the end of the slot
+		swapSize, swapInfo, copyDone, imageOK, keys, status int
+		statusEntries                                       int
+	}{
+		{
+			name:     "swap-scratch",
+			opts:     nil,
+			swapSize: 48, swapInfo: 40, copyDone: 32, imageOK: 24,
+			status: 48 + 128*3*4, statusEntries: 128 * 3,
+		},
+		{
+			name:     "swap-scratch encrypted",
+			opts:     &TrailerOptions{Mode: SwapModeScratch, EncKeySize: 16},
+			swapSize: 48, swapInfo: 40, copyDone: 32, imageOK: 24, keys: 48,
+			status: 48 + 2*16 + 128*3*4, statusEntries: 128 * 3,
+		},
+		{
+			name:     "swap-move",
+			opts:     &TrailerOptions{Mode: SwapModeMove},
+			swapSize: 48, swapInfo: 40, copyDone: 32, imageOK: 24,
+			status: 48 + 128*2*4, statusEntries: 128 * 2,
+		},
+		{
+			name:     "swap-offset aligned to 32",
+			opts:     &TrailerOptions{Mode: SwapModeOffset, MaxAlign: 32, EncKeySize: 32},
+			swapSize: 160, swapInfo: 128, copyDone: 96, imageOK: 64, keys: 160,
+			status: 160 + 2*32 + 128*2*4, statusEntries: 128 * 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slot := bytes.Repeat([]byte{bootErased}, slotSize)
+			end := slotSize
+			binary.LittleEndian.PutUint32(slot[end-tt.swapSize:], 0x3000)
+			slot[end-tt.swapInfo] = 0x12 // image 1, test swap
+			slot[end-tt.copyDone] = bootFlagSet
+			slot[end-tt.imageOK] = 0x00
+			copy(slot[end-bootMagicSize:], bootImgMagic)
+			keySize := tt.opts.encKeySize()
+			if keySize != 0 {
+				slotLen := alignUp(keySize, tt.opts.maxAlign())
+				copy(slot[end-tt.keys-slotLen:], key0[:keySize])
+				copy(slot[end-tt.keys-2*slotLen:], key1[:keySize])
+			}
+			// Two sectors swapped so far.
+			copy(slot[end-tt.status:], []byte{1, 0xff, 0xff, 0xff, 2})
+
+			tr, err := ReadImageTrailer(bytes.NewReader(slot), slotSize, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tr.Magic != TrailerGood || tr.CopyDone != TrailerGood || tr.ImageOK != TrailerBad {
+				t.Errorf("magic %v, copy_done %v, image_ok %v", tr.Magic, tr.CopyDone, tr.ImageOK)
+			}
+			if tr.SwapType != SwapTypeTest || tr.ImageNum != 1 || tr.SwapSize != 0x3000 {
+				t.Errorf("swap type %v, image %d, swap size %#x", tr.SwapType, tr.ImageNum, tr.SwapSize)
+			}
+			if len(tr.Status) != tt.statusEntries || tr.StatusCount() != 2 {
+				t.Errorf("%d status entries with %d written", len(tr.Status), tr.StatusCount())
+			}
+			if keySize == 0 {
+				if tr.EncKeys != nil {
+					t.Errorf("found %d key slots", len(tr.EncKeys))
+				}
+				return
+			}
+			if len(tr.EncKeys) != 2 || !bytes.Equal(tr.EncKeys[0], key0[:keySize]) || !bytes.Equal(tr.EncKeys[1], key1[:keySize]) {
+				t.Errorf("key slots = %x", tr.EncKeys)
+			}
+		})
+	}
+}
+
+func TestSetPending(t *testing.T) {
+	const slotSize = 0x2000
+	for _, opts := range []*TrailerOptions{nil, {Mode: SwapModeMove, MaxAlign: 32}} {
+		secondary := slotBuffer(bytes.Repeat([]byte{bootErased}, slotSize))
+		if err := SetPending(secondary, slotSize, false, opts); err != nil {
+			t.Fatal(err)
+		}
+		primary := slotBuffer(bytes.Repeat([]byte{bootErased}, slotSize))
+		if err := SetConfirmed(primary, slotSize, opts); err != nil {
+			t.Fatal(err)
+		}
+		s, err := ReadImageTrailer(bytes.NewReader(secondary), slotSize, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := ReadImageTrailer(bytes.NewReader(primary), slotSize, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.SwapType != SwapTypeTest || BootSwapType(p, s) != SwapTypeTest {
+			t.Errorf("align %d: pending swap type %v", opts.maxAlign(), BootSwapType(p, s))
+		}
+		if p.Magic != TrailerGood || p.ImageOK != TrailerGood {
+			t.Errorf("align %d: confirmed trailer magic %v, image_ok %v", opts.maxAlign(), p.Magic, p.ImageOK)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package nrf
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Verify recomputes the image hash over the header, body and protected TLVs,
+// compares it with the hash TLV and verifies the signature TLV with pubKey.
+// pubKey is a PEM, DER or raw public key. The hash of an encrypted image
+// covers the plaintext, so such images do not verify as stored.
+func (b *MCUBoot) Verify(pubKey []byte) error {
+	key, err := parsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	area, err := b.ReadTLVArea()
+	if err != nil {
+		return err
+	}
+	if area.Signature == nil {
+		return errors.New("mcu-boot: image is not signed")
+	}
+	der, err := marshalMCUBootKey(key)
+	if err != nil {
+		return err
+	}
+	if (area.KeyHash != nil || area.PublicKey != nil) && !area.VerifyPK(der) {
+		return errors.New("mcu-boot: key does not match the key hash")
+	}
+	var digest []byte
+	if area.ImageHash != nil {
+		digest, err = b.imageHash(area.HashType)
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare(digest, area.ImageHash) == 0 {
+			return errors.New("mcu-boot: image hash mismatch")
+		}
+	}
+	if area.Pure {
+		msg, err := b.signedData()
+		if err != nil {
+			return err
+		}
+		if area.SigType != ImageTLVED25519 {
+			return errors.New("mcu-boot: pure signatures require ed25519")
+		}
+		return VerifyWith(Ed25519, key, 0, msg, area.Signature)
+	}
+	return verifyMCUBootSignature(key, area.SigType, area.HashType, digest, area.Signature)
+}
+
+// signedSize is the size of the header, body and protected TLVs.
+func (b *MCUBoot) signedSize() int64 {
+	h := b.header
+	return int64(h.Size) + int64(h.ImgSize) + int64(h.ProtectedTLVSize)
+}
+
+func (b *MCUBoot) signedData() ([]byte, error) {
+	out := make([]byte, b.signedSize())
+	if _, err := b.r.ReadAt(out, b.base); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (b *MCUBoot) imageHash(t TLVType) ([]byte, error) {
+	h, err := newImageHash(t)
+	if err != nil {
+		return nil, err
+	}
+	r := io.NewSectionReader(b.r, b.base, b.signedSize())
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func newImageHash(t TLVType) (hash.Hash, error) {
+	switch t {
+	case ImageTLVSHA256:
+		return sha256.New(), nil
+	case ImageTLVSHA384:
+		return sha512.New384(), nil
+	case ImageTLVSHA512:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("mcu-boot: unsupported hash tlv 0x%02x", int(t))
+}
+
+func hashFunc(t TLVType) crypto.Hash {
+	switch t {
+	case ImageTLVSHA384:
+		return crypto.SHA384
+	case ImageTLVSHA512:
+		return crypto.SHA512
+	}
+	return crypto.SHA256
+}
+
+func verifyMCUBootSignature(key any, sigType, hashType TLVType, digest, sig []byte) error {
+	alg, err := mcuBootSigAlgorithm(key, sigType)
+	if err != nil {
+		return err
+	}
+	return VerifyWith(alg, key, hashFunc(hashType), digest, sig)
+}
+
+// mcuBootSigAlgorithm maps a signature TLV to the verifier algorithm.
+func mcuBootSigAlgorithm(key any, sigType TLVType) (SignatureAlgorithm, error) {
+	switch sigType {
+	case ImageTLVRsa2048PSS:
+		return RSAPSS2048, nil
+	case ImageTLVRsa3072PSS:
+		return RSAPSS3072, nil
+	case ImageTLVED25519:
+		return Ed25519, nil
+	case ImageTLVEcdsaSig:
+		if pk, ok := key.(*ecdsa.PublicKey); ok && pk.Curve == elliptic.P384() {
+			return ECDSAP384SHA384, nil
+		}
+		return ECDSAP256SHA256, nil
+	}
+	return 0, fmt.Errorf("mcu-boot: unsupported signature tlv 0x%02x", int(sigType))
+}
+
+// marshalMCUBootKey encodes the key the way it is embedded in the bootloader
+// and hashed into the KEYHASH TLV.
+func marshalMCUBootKey(key any) ([]byte, error) {
+	if pk, ok := key.(*rsa.PublicKey); ok {
+		return x509.MarshalPKCS1PublicKey(pk), nil
+	}
+	return x509.MarshalPKIXPublicKey(key)
+}
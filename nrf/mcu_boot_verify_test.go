@@ -0,0 +1,103 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+// signTestImage builds an image with a SHA256, KEYHASH and signature TLV
+// computed here rather than by the signer.
+func signTestImage(t *testing.T, body []byte, pub any, sigType TLVType, sign func(digest, msg []byte) []byte) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyHash := sha256.Sum256(der)
+	protected := []testTLV{{ImageTLVEncSecCnt, []byte{1, 0, 0, 0}}}
+	unsigned := buildTestImage(body, protected, nil)
+	msg := unsigned[:len(unsigned)-4]
+	digest := sha256.Sum256(msg)
+	return buildTestImage(body, protected, []testTLV{
+		{ImageTLVSHA256, digest[:]},
+		{ImageTLVKeyHash, keyHash[:]},
+		{sigType, sign(digest[:], msg)},
+	})
+}
+
+func openTestImage(t *testing.T, img []byte) *MCUBoot {
+	t.Helper()
+	b, err := NewMCUBoot(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func pemPublicKey(t *testing.T, pub any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestVerifyMCUBoot(t *testing.T) {
+	body := bytes.Repeat([]byte{0x10, 0xb5, 0x00, 0xbf}, 0x40)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecImg := signTestImage(t, body, &ecKey.PublicKey, ImageTLVEcdsaSig, func(digest, _ []byte) []byte {
+		sig, err := ecdsa.SignASN1(rand.Reader, ecKey, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	})
+	edImg := signTestImage(t, body, edPub, ImageTLVED25519, func(digest, _ []byte) []byte {
+		return ed25519.Sign(edKey, digest)
+	})
+
+	if err := openTestImage(t, ecImg).Verify(pemPublicKey(t, &ecKey.PublicKey)); err != nil {
+		t.Errorf("ecdsa p-256: %v", err)
+	}
+	if err := openTestImage(t, edImg).Verify(pemPublicKey(t, edPub)); err != nil {
+		t.Errorf("ed25519: %v", err)
+	}
+
+	if err := openTestImage(t, ecImg).Verify(pemPublicKey(t, &other.PublicKey)); err == nil {
+		t.Error("image verified with a key that does not match the key hash")
+	}
+	tampered := bytes.Clone(ecImg)
+	tampered[0x20] ^= 1
+	if err := openTestImage(t, tampered).Verify(pemPublicKey(t, &ecKey.PublicKey)); err == nil {
+		t.Error("image with a modified body verified")
+	}
+	badSig := bytes.Clone(edImg)
+	badSig[len(badSig)-1] ^= 1
+	if err := openTestImage(t, badSig).Verify(pemPublicKey(t, edPub)); err == nil {
+		t.Error("image with a modified signature verified")
+	}
+	unsigned := buildTestImage(body, nil, []testTLV{{ImageTLVSHA256, make([]byte, 32)}})
+	if err := openTestImage(t, unsigned).Verify(pemPublicKey(t, edPub)); err == nil {
+		t.Error("unsigned image verified")
+	}
+}
@@ -0,0 +1,120 @@
+package nrf
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseImgVersion parses versions written as major.minor.revision+build,
+// as accepted by imgtool. The build number may also be given as a fourth
+// dot-separated field.
+func ParseImgVersion(s string) (ImgVersion, error) {
+	var v ImgVersion
+	s, build, hasBuild := strings.Cut(s, "+")
+	parts := strings.Split(s, ".")
+	if len(parts) == 4 && !hasBuild {
+		build, hasBuild = parts[3], true
+		parts = parts[:3]
+	}
+	if len(parts) > 3 {
+		return v, fmt.Errorf("invalid image version %q", s)
+	}
+	bits := []int{8, 8, 16}
+	var fields [3]uint64
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, bits[i])
+		if err != nil {
+			return v, fmt.Errorf("invalid image version %q: %w", s, err)
+		}
+		fields[i] = n
+	}
+	v.Major = uint8(fields[0])
+	v.Minor = uint8(fields[1])
+	v.Revision = uint16(fields[2])
+	if hasBuild {
+		n, err := strconv.ParseUint(build, 10, 32)
+		if err != nil {
+			return ImgVersion{}, fmt.Errorf("invalid build number %q: %w", build, err)
+		}
+		v.BuildNum = uint32(n)
+	}
+	return v, nil
+}
+
+func (v ImgVersion) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Revision)
+	if v.BuildNum != 0 {
+		s += "+" + strconv.FormatUint(uint64(v.BuildNum), 10)
+	}
+	return s
+}
+
+// Compare returns -1, 0 or +1 by major, minor and revision, and then by
+// build number.
+func (v ImgVersion) Compare(o ImgVersion) int {
+	if c := compareImgVersion(v, o); c != 0 {
+		return c
+	}
+	return cmp.Compare(v.BuildNum, o.BuildNum)
+}
+
+// compareImgVersion ignores the build number, as MCUboot does unless
+// MCUBOOT_VERSION_CMP_USE_BUILD_NUMBER is set.
+func compareImgVersion(a, b ImgVersion) int {
+	if c := cmp.Compare(a.Major, b.Major); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Minor, b.Minor); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Revision, b.Revision)
+}
+
+// SecurityCounter returns the value of the security counter TLV.
+func (b *MCUBoot) SecurityCounter() (uint32, bool, error) {
+	tlvs, err := b.TLVs()
+	if err != nil {
+		return 0, false, err
+	}
+	for _, tlv := range tlvs {
+		if tlv.Type == ImageTLVEncSecCnt && len(tlv.Data) == 4 {
+			return binary.LittleEndian.Uint32(tlv.Data), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+var (
+	VersionDowngrade         = errors.New("mcu-boot: image version is lower than the installed image")
+	SecurityCounterDowngrade = errors.New("mcu-boot: security counter is lower than the installed image")
+)
+
+// CheckDowngrade rejects a candidate image whose version or security counter
+// is lower than that of the installed image, mirroring MCUboot's downgrade
+// prevention. useBuildNum also compares build numbers.
+func CheckDowngrade(installed, candidate *MCUBoot, useBuildNum bool) error {
+	cur, next := installed.header.Ver, candidate.header.Ver
+	c := compareImgVersion(next, cur)
+	if useBuildNum {
+		c = next.Compare(cur)
+	}
+	if c < 0 {
+		return fmt.Errorf("%w: %s < %s", VersionDowngrade, next, cur)
+	}
+	curCnt, ok, err := installed.SecurityCounter()
+	if err != nil || !ok {
+		return err
+	}
+	nextCnt, _, err := candidate.SecurityCounter()
+	if err != nil {
+		return err
+	}
+	if nextCnt < curCnt {
+		return fmt.Errorf("%w: %d < %d", SecurityCounterDowngrade, nextCnt, curCnt)
+	}
+	return nil
+}
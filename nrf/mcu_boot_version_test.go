@@ -0,0 +1,100 @@
+package nrf
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestParseImgVersion(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want ImgVersion
+		str  string
+	}{
+		{"1", ImgVersion{Major: 1}, "1.0.0"},
+		{"1.2.3", ImgVersion{Major: 1, Minor: 2, Revision: 3}, "1.2.3"},
+		{"1.2.3+4", ImgVersion{Major: 1, Minor: 2, Revision: 3, BuildNum: 4}, "1.2.3+4"},
+		{"1.2.3.4", ImgVersion{Major: 1, Minor: 2, Revision: 3, BuildNum: 4}, "1.2.3+4"},
+		{"255.255.65535+4294967295", ImgVersion{Major: 255, Minor: 255, Revision: 65535, BuildNum: 4294967295}, "255.255.65535+4294967295"},
+	} {
+		v, err := ParseImgVersion(tt.in)
+		if err != nil {
+			t.Errorf("ParseImgVersion(%q): %v", tt.in, err)
+			continue
+		}
+		if v != tt.want || v.String() != tt.str {
+			t.Errorf("ParseImgVersion(%q) = %s, want %s", tt.in, v, tt.str)
+		}
+	}
+	for _, in := range []string{"", "1.2.3.4.5", "1.2.3.4+5", "256.0.0", "1.x.0", "1.2.3+"} {
+		if _, err := ParseImgVersion(in); err == nil {
+			t.Errorf("ParseImgVersion(%q) succeeded", in)
+		}
+	}
+}
+
+func TestImgVersionCompare(t *testing.T) {
+	for _, tt := range []struct {
+		a, b         string
+		cmp, noBuild int
+	}{
+		{"1.2.3", "1.2.3", 0, 0},
+		{"1.2.3", "1.2.4", -1, -1},
+		{"1.3.0", "1.2.9", 1, 1},
+		{"2.0.0", "1.255.65535", 1, 1},
+		{"1.2.3+1", "1.2.3+2", -1, 0},
+	} {
+		a, _ := ParseImgVersion(tt.a)
+		b, _ := ParseImgVersion(tt.b)
+		if c := a.Compare(b); c != tt.cmp {
+			t.Errorf("%s.Compare(%s) = %d, want %d", a, b, c, tt.cmp)
+		}
+		if c := compareImgVersion(a, b); c != tt.noBuild {
+			t.Errorf("compareImgVersion(%s, %s) = %d, want %d", a, b, c, tt.noBuild)
+		}
+	}
+}
+
+func versionTestImage(t *testing.T, ver ImgVersion, counter *uint32) *MCUBoot {
+	t.Helper()
+	var protected []testTLV
+	if counter != nil {
+		protected = append(protected, testTLV{ImageTLVEncSecCnt, binary.LittleEndian.AppendUint32(nil, *counter)})
+	}
+	img := buildTestImage([]byte{1, 2, 3, 4}, protected, []testTLV{{ImageTLVSHA256, make([]byte, 32)}})
+	img[20], img[21] = ver.Major, ver.Minor
+	binary.LittleEndian.PutUint16(img[22:], ver.Revision)
+	binary.LittleEndian.PutUint32(img[24:], ver.BuildNum)
+	return openTestImage(t, img)
+}
+
+func TestCheckDowngrade(t *testing.T) {
+	cnt := func(n uint32) *uint32 { return &n }
+	installed := versionTestImage(t, ImgVersion{Major: 1, Minor: 2, BuildNum: 5}, cnt(3))
+	for _, tt := range []struct {
+		name        string
+		ver         ImgVersion
+		counter     *uint32
+		useBuildNum bool
+		want        error
+	}{
+		{"upgrade", ImgVersion{Major: 1, Minor: 3}, cnt(3), false, nil},
+		{"same version", ImgVersion{Major: 1, Minor: 2}, cnt(4), false, nil},
+		{"older build", ImgVersion{Major: 1, Minor: 2, BuildNum: 4}, cnt(3), false, nil},
+		{"older build compared", ImgVersion{Major: 1, Minor: 2, BuildNum: 4}, cnt(3), true, VersionDowngrade},
+		{"older version", ImgVersion{Major: 1, Minor: 1, Revision: 9}, cnt(3), false, VersionDowngrade},
+		{"lower counter", ImgVersion{Major: 2}, cnt(2), false, SecurityCounterDowngrade},
+		{"no counter", ImgVersion{Major: 2}, nil, false, SecurityCounterDowngrade},
+	} {
+		err := CheckDowngrade(installed, versionTestImage(t, tt.ver, tt.counter), tt.useBuildNum)
+		if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("%s: CheckDowngrade = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	// Images without a counter are compared by version only.
+	old := versionTestImage(t, ImgVersion{Major: 1}, nil)
+	if err := CheckDowngrade(old, versionTestImage(t, ImgVersion{Major: 1, Minor: 1}, nil), false); err != nil {
+		t.Error(err)
+	}
+}
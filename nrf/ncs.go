@@ -0,0 +1,249 @@
+package nrf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/hex"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// BuildProfile describes how a Zephyr or nRF Connect SDK image was built.
+type BuildProfile struct {
+	// ImageVersion is the version in the MCUboot image header.
+	ImageVersion   string
+	ZephyrVersion  string
+	NCSVersion     string
+	MCUBootVersion string
+	// Banners are the boot banners found in the image and the bootloader.
+	Banners []string
+	// SDC and MPSL report whether the SoftDevice Controller and the
+	// Multiprotocol Service Layer are linked in. The build IDs are only
+	// known when the image has symbols or comes with its ELF file.
+	SDC         bool
+	SDCBuildID  string
+	MPSL        bool
+	MPSLBuildID string
+	// Configs are the CONFIG_ names, with values when present, found in
+	// the image strings.
+	Configs []string
+}
+
+var (
+	zephyrBanner = regexp.MustCompile(`\*\*\* (?:Booting|Using) [ -~]+? \*\*\*`)
+	zephyrOS     = regexp.MustCompile(`(?:Booting|Using) Zephyr OS (?:build |version )?(v?\d+\.\d+\.\d+[\w.+-]*)`)
+	ncsVersion   = regexp.MustCompile(`(?:Booting|Using) nRF Connect SDK (?:build )?(v?\d+\.\d+\.\d+[\w.+-]*)`)
+	mcuBootVer   = regexp.MustCompile(`(?:Booting|Starting) MCUboot (?:build )?(v?\d+\.\d+\.\d+[\w.+-]*)`)
+	kconfigName  = regexp.MustCompile(`\bCONFIG_[A-Z0-9_]{2,}(?:=[ -~]*)?`)
+)
+
+// Strings left by the SoftDevice Controller and MPSL, such as their
+// assert messages.
+var (
+	sdcMarkers  = []string{"SoftDevice Controller ASSERT", "sdc_init", "sdc_enable"}
+	mpslMarkers = []string{"MPSL ASSERT", "mpsl_init", "mpsl_lib_init"}
+)
+
+// Entry points of the SoftDevice Controller and MPSL libraries. The sdc_
+// and mpsl_ prefixes alone are not enough, applications use them too.
+var (
+	sdcSymbols  = []string{"sdc_init", "sdc_enable"}
+	mpslSymbols = []string{"mpsl_init", "mpsl_lib_init"}
+)
+
+// DetectBuildProfile finds the first MCUboot image in the file and
+// returns its build profile.
+func DetectBuildProfile(name string) (*BuildProfile, error) {
+	b, err := DetectMCUBoot(name)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+	return b.BuildProfile()
+}
+
+// DetectBuildProfileWithELF is DetectBuildProfile for a signed image, such
+// as zephyr.signed.bin, with the ELF file it was built from.
+func DetectBuildProfileWithELF(name, elfName string) (*BuildProfile, error) {
+	b, err := DetectMCUBoot(name)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+	return b.BuildProfileWithELF(elfName)
+}
+
+// BuildProfile scans the image body, and the bootloader in front of it
+// when the file holds both, for Zephyr and NCS build metadata.
+func (b *MCUBoot) BuildProfile() (*BuildProfile, error) {
+	img, err := b.ExtractImage()
+	if err != nil {
+		return nil, err
+	}
+	return b.buildProfile(img)
+}
+
+// buildProfile is BuildProfile with the image body already extracted.
+func (b *MCUBoot) buildProfile(img []byte) (*BuildProfile, error) {
+	p := &BuildProfile{ImageVersion: b.header.Ver.String()}
+	p.scan(img)
+	if b.base > 0 {
+		boot := make([]byte, b.base)
+		if _, err := b.r.ReadAt(boot, 0); err != nil && err != io.EOF {
+			return nil, err
+		}
+		bp := &BuildProfile{}
+		bp.scan(boot)
+		if p.MCUBootVersion == "" {
+			p.MCUBootVersion = bp.MCUBootVersion
+		}
+		for _, banner := range bp.Banners {
+			p.Banners = appendUnique(p.Banners, banner)
+		}
+	}
+	p.addSymbols(b.symbols, b.readBuildID)
+	return p, nil
+}
+
+// BuildProfileWithELF is BuildProfile with the symbols of the ELF file the
+// image was built from. Signed images have no symbols of their own. Build
+// IDs are only reported when they occur in the image body, so an ELF from
+// another build is not mistaken for this one.
+func (b *MCUBoot) BuildProfileWithELF(elfName string) (*BuildProfile, error) {
+	img, err := b.ExtractImage()
+	if err != nil {
+		return nil, err
+	}
+	p, err := b.buildProfile(img)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(elfName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	e, err := ReadElf(f)
+	if err != nil {
+		return nil, err
+	}
+	p.addSymbols(e.symbols, func(sym elf.Symbol) []byte {
+		if sym.Size == 0 || sym.Size > 0x40 {
+			return nil
+		}
+		id := e.image.BinaryRange(uint32(sym.Value), uint32(sym.Value+sym.Size))
+		if !bytes.Contains(img, id) {
+			return nil
+		}
+		return id
+	})
+	return p, nil
+}
+
+// addSymbols sets SDC and MPSL and their build IDs from a symbol table.
+func (p *BuildProfile) addSymbols(symbols []elf.Symbol, readBuildID func(elf.Symbol) []byte) {
+	for _, sym := range symbols {
+		switch {
+		case slices.Contains(sdcSymbols, sym.Name):
+			p.SDC = true
+		case slices.Contains(mpslSymbols, sym.Name):
+			p.MPSL = true
+		}
+		if !strings.HasSuffix(sym.Name, "build_revision") || elf.ST_TYPE(sym.Info) != elf.STT_OBJECT {
+			continue
+		}
+		id := readBuildID(sym)
+		if id == nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(sym.Name, "sdc_"):
+			p.SDC = true
+			p.SDCBuildID = hex.EncodeToString(id)
+		case strings.HasPrefix(sym.Name, "mpsl_"):
+			p.MPSL = true
+			p.MPSLBuildID = hex.EncodeToString(id)
+		}
+	}
+}
+
+// readBuildID reads a build revision symbol, which holds a SHA-1.
+func (b *MCUBoot) readBuildID(sym elf.Symbol) []byte {
+	if sym.Size == 0 || sym.Size > 0x40 {
+		return nil
+	}
+	id := make([]byte, sym.Size)
+	if _, err := b.r.ReadAt(id, int64(sym.Value)); err != nil {
+		return nil
+	}
+	return id
+}
+
+func (p *BuildProfile) scan(b []byte) {
+	for _, s := range printableStrings(b, 6) {
+		for _, banner := range zephyrBanner.FindAllString(s, -1) {
+			p.Banners = appendUnique(p.Banners, banner)
+		}
+		if m := zephyrOS.FindStringSubmatch(s); m != nil && p.ZephyrVersion == "" {
+			p.ZephyrVersion = m[1]
+		}
+		if m := ncsVersion.FindStringSubmatch(s); m != nil && p.NCSVersion == "" {
+			p.NCSVersion = m[1]
+		}
+		if m := mcuBootVer.FindStringSubmatch(s); m != nil && p.MCUBootVersion == "" {
+			p.MCUBootVersion = m[1]
+		}
+		for _, c := range kconfigName.FindAllString(s, -1) {
+			p.Configs = appendUnique(p.Configs, c)
+		}
+		if !p.SDC && containsAny(s, sdcMarkers) {
+			p.SDC = true
+		}
+		if !p.MPSL && containsAny(s, mpslMarkers) {
+			p.MPSL = true
+		}
+	}
+	slices.Sort(p.Configs)
+}
+
+// printableStrings returns the runs of printable ASCII of at least n
+// bytes, like strings(1).
+func printableStrings(b []byte, n int) []string {
+	var out []string
+	start := -1
+	for i, c := range b {
+		if c >= 0x20 && c < 0x7f {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= n {
+			out = append(out, string(b[start:i]))
+		}
+		start = -1
+	}
+	if start >= 0 && len(b)-start >= n {
+		out = append(out, string(b[start:]))
+	}
+	return out
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(s []string, v string) []string {
+	if slices.Contains(s, v) {
+		return s
+	}
+	return append(s, v)
+}
@@ -0,0 +1,132 @@
+package nrf
+
+import (
+	"bytes"
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPrintableStrings(t *testing.T) {
+	b := []byte("\x00\x01short\x00long enough\xff\x10tail at the end")
+	want := []string{"long enough", "tail at the end"}
+	if got := printableStrings(b, 6); !slices.Equal(got, want) {
+		t.Errorf("printableStrings = %q, want %q", got, want)
+	}
+}
+
+// joinStrings lays out strings as in .rodata: NUL terminated with padding.
+func joinStrings(s ...string) []byte {
+	var b []byte
+	for _, v := range s {
+		b = append(b, v...)
+		b = append(b, 0, 0xff, 0x12, 0)
+	}
+	return b
+}
+
+func TestBuildProfileScan(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		strings []string
+		zephyr  string
+		ncs     string
+		mcuboot string
+		banners int
+		configs []string
+		sdc     bool
+		mpsl    bool
+	}{
+		{
+			name: "ncs 2.5",
+			strings: []string{
+				"*** Booting nRF Connect SDK v2.5.0-4e0e6ae2fa6c ***",
+				"*** Using Zephyr OS v3.4.99-ncs1 ***",
+				"CONFIG_BT=y", "SoftDevice Controller ASSERT: %d, %d",
+			},
+			zephyr: "v3.4.99-ncs1", ncs: "v2.5.0-4e0e6ae2fa6c", banners: 2,
+			configs: []string{"CONFIG_BT=y"}, sdc: true,
+		},
+		{
+			name: "older zephyr",
+			strings: []string{
+				"*** Booting Zephyr OS build v3.2.99-ncs2 ***",
+				"MPSL ASSERT: %d, %d",
+				"CONFIG_BOARD_NRF52840DK_NRF52840", "CONFIG_BT=y",
+			},
+			zephyr: "v3.2.99-ncs2", banners: 1,
+			configs: []string{"CONFIG_BOARD_NRF52840DK_NRF52840", "CONFIG_BT=y"}, mpsl: true,
+		},
+		{
+			name:    "mcuboot",
+			strings: []string{"*** Booting MCUboot v2.0.99-dev ***", "Jumping to the first image slot"},
+			mcuboot: "v2.0.99-dev", banners: 1,
+		},
+	} {
+		p := &BuildProfile{}
+		p.scan(joinStrings(tt.strings...))
+		if p.ZephyrVersion != tt.zephyr || p.NCSVersion != tt.ncs || p.MCUBootVersion != tt.mcuboot {
+			t.Errorf("%s: zephyr %q, ncs %q, mcuboot %q", tt.name, p.ZephyrVersion, p.NCSVersion, p.MCUBootVersion)
+		}
+		if len(p.Banners) != tt.banners {
+			t.Errorf("%s: banners = %q", tt.name, p.Banners)
+		}
+		if !slices.Equal(p.Configs, tt.configs) {
+			t.Errorf("%s: configs = %q, want %q", tt.name, p.Configs, tt.configs)
+		}
+		if p.SDC != tt.sdc || p.MPSL != tt.mpsl {
+			t.Errorf("%s: sdc %v, mpsl %v", tt.name, p.SDC, p.MPSL)
+		}
+	}
+}
+
+func TestBuildProfileWithELF(t *testing.T) {
+	buildID := bytes.Repeat([]byte{0x5d}, 20)
+	body := append(joinStrings("*** Booting nRF Connect SDK v2.6.1 ***", "*** Using Zephyr OS v3.5.99-ncs1 ***"), buildID...)
+	img := buildTestImage(body, nil, []testTLV{{ImageTLVSHA256, make([]byte, 32)}})
+	b := openTestImage(t, img)
+
+	text := append(make([]byte, 0x40), buildID...)
+	writeElf := func(syms []testSymbol) string {
+		name := filepath.Join(t.TempDir(), "zephyr.elf")
+		elfFile := buildTestElf(t, []testSegment{{vaddr: 0x1000, paddr: 0x1000, data: text}}, syms)
+		if err := os.WriteFile(name, elfFile, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+
+	// Application symbols with the library prefixes.
+	p, err := b.BuildProfileWithELF(writeElf([]testSymbol{
+		{"sdc_hci_app_handler", 0x1001, 0x10, elf.STT_FUNC},
+		{"mpsl_app_timer", 0x1011, 0x10, elf.STT_FUNC},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SDC || p.MPSL {
+		t.Errorf("sdc %v, mpsl %v from application symbols", p.SDC, p.MPSL)
+	}
+	if p.NCSVersion != "v2.6.1" || p.ZephyrVersion != "v3.5.99-ncs1" || p.ImageVersion != "1.2.3" {
+		t.Errorf("profile = %+v", p)
+	}
+
+	p, err = b.BuildProfileWithELF(writeElf([]testSymbol{
+		{"sdc_init", 0x1001, 0x10, elf.STT_FUNC},
+		{"mpsl_init", 0x1011, 0x10, elf.STT_FUNC},
+		{"sdc_build_revision", 0x1040, 20, elf.STT_OBJECT},
+		// Not in the image body: from another build.
+		{"mpsl_build_revision", 0x1000, 20, elf.STT_OBJECT},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.SDC || !p.MPSL {
+		t.Errorf("sdc %v, mpsl %v", p.SDC, p.MPSL)
+	}
+	if p.SDCBuildID != "5d5d5d5d5d5d5d5d5d5d5d5d5d5d5d5d5d5d5d5d" || p.MPSLBuildID != "" {
+		t.Errorf("build ids = %q, %q", p.SDCBuildID, p.MPSLBuildID)
+	}
+}
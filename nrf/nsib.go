@@ -0,0 +1,261 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Nordic Secure Immutable Bootloader (NSIB, also known as B0) structures.
+const (
+	fwInfoMagicCommon     = 0x281ee6de
+	fwInfoMagicFwInfo     = 0x8fcebb4c
+	fwInfoMagicValidation = 0x86518483
+	fwInfoValidVal        = 0x9102FFFF
+	// key_data.valid of a revoked key
+	provisionKeyInvalid = 0xFFFF0000
+	// SB_PUBLIC_KEY_HASH_LEN
+	provisionKeyHashSize = 16
+	// validation info is searched after the image in this window
+	fwValidationSearchSize = 0x400
+)
+
+// fw_info is placed at one of these offsets from the start of a slot.
+var fwInfoOffsets = []int64{0x0, 0x200, 0x400, 0x800, 0x1000}
+
+// FwInfo is the fw_info struct of an NSIB firmware slot.
+type FwInfo struct {
+	Magic        [3]uint32
+	TotalSize    uint32
+	Size         uint32
+	Version      uint32
+	Address      uint32
+	BootAddress  uint32
+	Valid        uint32
+	Reserved     [4]uint32
+	ExtAPINum    uint32
+	ExtAPIReqNum uint32
+}
+
+// IsValid reports whether the image has not been invalidated.
+func (f *FwInfo) IsValid() bool {
+	return f.Valid == fwInfoValidVal
+}
+
+// FwValidationInfo is the fw_validation_info struct appended to an image.
+type FwValidationInfo struct {
+	Magic     [3]uint32
+	Address   uint32
+	Hash      [32]uint8
+	PublicKey [64]uint8
+	Signature [64]uint8
+}
+
+// ProvisionedKey is a public key hash entry of the provisioning data.
+type ProvisionedKey struct {
+	Valid bool
+	Hash  []byte
+}
+
+// MonotonicCounter is a counter of the provisioning data. Every update
+// writes the next slot.
+type MonotonicCounter struct {
+	Type  uint16
+	Slots []uint16
+}
+
+// Value returns the highest written slot value.
+func (c *MonotonicCounter) Value() uint16 {
+	var v uint16
+	for _, s := range c.Slots {
+		if s != 0xFFFF && s > v {
+			v = s
+		}
+	}
+	return v
+}
+
+// ProvisionData is the bl_storage_data provisioned to OTP or flash.
+type ProvisionData struct {
+	S0Address uint32
+	S1Address uint32
+	Keys      []ProvisionedKey
+	Counters  []MonotonicCounter
+}
+
+// ParseProvisionData decodes the provisioning area.
+func ParseProvisionData(b []byte) (*ProvisionData, error) {
+	r := bytes.NewReader(b)
+	var hdr struct {
+		S0Address     uint32
+		S1Address     uint32
+		NumPublicKeys uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.NumPublicKeys == 0xFFFFFFFF {
+		return nil, errors.New("nsib: provisioning data is erased")
+	}
+	if int64(hdr.NumPublicKeys)*(4+provisionKeyHashSize) > int64(r.Len()) {
+		return nil, errors.New("nsib: invalid number of public keys")
+	}
+	p := &ProvisionData{S0Address: hdr.S0Address, S1Address: hdr.S1Address}
+	for i := uint32(0); i < hdr.NumPublicKeys; i++ {
+		var key struct {
+			Valid uint32
+			Hash  [provisionKeyHashSize]uint8
+		}
+		if err := binary.Read(r, binary.LittleEndian, &key); err != nil {
+			return nil, err
+		}
+		p.Keys = append(p.Keys, ProvisionedKey{
+			Valid: key.Valid != provisionKeyInvalid,
+			Hash:  bytes.Clone(key.Hash[:]),
+		})
+	}
+	counters, err := readMonotonicCounters(r)
+	if err != nil {
+		return nil, err
+	}
+	p.Counters = counters
+	return p, nil
+}
+
+func readMonotonicCounters(r *bytes.Reader) ([]MonotonicCounter, error) {
+	var hdr struct {
+		Type        uint16
+		NumCounters uint16
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		// The counter collection is optional.
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if hdr.Type == 0xFFFF {
+		return nil, nil
+	}
+	var counters []MonotonicCounter
+	for i := uint16(0); i < hdr.NumCounters; i++ {
+		var ch struct {
+			Type     uint16
+			NumSlots uint16
+		}
+		if err := binary.Read(r, binary.LittleEndian, &ch); err != nil {
+			return nil, err
+		}
+		slots := make([]uint16, ch.NumSlots)
+		if err := binary.Read(r, binary.LittleEndian, slots); err != nil {
+			return nil, err
+		}
+		counters = append(counters, MonotonicCounter{Type: ch.Type, Slots: slots})
+	}
+	return counters, nil
+}
+
+// FindFwInfo looks for fw_info at the offsets NSIB checks from slotAddr.
+// r is addressed by flash address.
+func FindFwInfo(r io.ReaderAt, slotAddr int64) (*FwInfo, error) {
+	for _, off := range fwInfoOffsets {
+		b := make([]byte, binary.Size(FwInfo{}))
+		if _, err := r.ReadAt(b, slotAddr+off); err != nil {
+			continue
+		}
+		var info FwInfo
+		if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &info); err != nil {
+			return nil, err
+		}
+		if info.Magic[0] == fwInfoMagicCommon && info.Magic[1] == fwInfoMagicFwInfo {
+			return &info, nil
+		}
+	}
+	return nil, errors.New("nsib: fw_info not found")
+}
+
+// FindValidationInfo finds the fw_validation_info that follows the image
+// described by info.
+func FindValidationInfo(r io.ReaderAt, info *FwInfo) (*FwValidationInfo, error) {
+	start := (int64(info.Address) + int64(info.Size) + 3) &^ 3
+	size := binary.Size(FwValidationInfo{})
+	b := make([]byte, fwValidationSearchSize+size)
+	n, err := r.ReadAt(b, start)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	b = b[:n]
+	for off := 0; off+size <= len(b); off += 4 {
+		var v FwValidationInfo
+		if err := binary.Read(bytes.NewReader(b[off:]), binary.LittleEndian, &v); err != nil {
+			return nil, err
+		}
+		if v.Magic[0] == fwInfoMagicCommon && v.Magic[1] == fwInfoMagicValidation && v.Address == info.Address {
+			return &v, nil
+		}
+	}
+	return nil, errors.New("nsib: fw_validation_info not found")
+}
+
+// KeyIndex returns the index of the provisioned key matching pk, a raw
+// P-256 public key.
+func (p *ProvisionData) KeyIndex(pk []byte) (int, error) {
+	h := sha256Sum(pk)[:provisionKeyHashSize]
+	for i, key := range p.Keys {
+		if subtle.ConstantTimeCompare(h, key.Hash) == 0 {
+			continue
+		}
+		if !key.Valid {
+			return i, fmt.Errorf("nsib: public key %d is revoked", i)
+		}
+		return i, nil
+	}
+	return -1, errors.New("nsib: public key is not provisioned")
+}
+
+// VerifySlot verifies the image of the slot at slotAddr against the
+// provisioned key hashes. r is addressed by flash address.
+func (p *ProvisionData) VerifySlot(r io.ReaderAt, slotAddr uint32) (*FwInfo, error) {
+	info, err := FindFwInfo(r, int64(slotAddr))
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsValid() {
+		return info, errors.New("nsib: image is invalidated")
+	}
+	v, err := FindValidationInfo(r, info)
+	if err != nil {
+		return info, err
+	}
+	if _, err := p.KeyIndex(v.PublicKey[:]); err != nil {
+		return info, err
+	}
+	fw := make([]byte, info.Size)
+	if _, err := r.ReadAt(fw, int64(info.Address)); err != nil {
+		return info, err
+	}
+	h := sha256.Sum256(fw)
+	if subtle.ConstantTimeCompare(h[:], v.Hash[:]) == 0 {
+		return info, errors.New("nsib: image hash mismatch")
+	}
+	pk, err := setP256PublicKey(v.PublicKey[:])
+	if err != nil {
+		return info, err
+	}
+	if !verifySignatureP256Digest(pk, h[:], v.Signature[:]) {
+		return info, errors.New("nsib: invalid signature")
+	}
+	return info, nil
+}
+
+// VerifyImages verifies the S0 and S1 slots. A nil error means the slot
+// holds a valid image signed with a provisioned key.
+func (p *ProvisionData) VerifyImages(r io.ReaderAt) (s0, s1 error) {
+	_, s0 = p.VerifySlot(r, p.S0Address)
+	_, s1 = p.VerifySlot(r, p.S1Address)
+	return s0, s1
+}
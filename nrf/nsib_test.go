@@ -0,0 +1,121 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+)
+
+// buildTestProvision writes bl_storage_data with one key hash per key and
+// one counter with two used slots.
+func buildTestProvision(s0, s1 uint32, keys [][]byte, valid []bool) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, [3]uint32{s0, s1, uint32(len(keys))})
+	for i, pk := range keys {
+		v := uint32(0x1505FFFF)
+		if !valid[i] {
+			v = provisionKeyInvalid
+		}
+		h := sha256.Sum256(pk)
+		binary.Write(&buf, binary.LittleEndian, v)
+		buf.Write(h[:provisionKeyHashSize])
+	}
+	binary.Write(&buf, binary.LittleEndian, []uint16{1, 1, 1, 4, 1, 2, 0xffff, 0xffff})
+	return buf.Bytes()
+}
+
+func TestNSIBVerifySlot(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := make([]byte, 64)
+	key.X.FillBytes(pk[:32])
+	key.Y.FillBytes(pk[32:])
+
+	const slot, size = 0x8000, 0x1000
+	flash := bytes.Repeat([]byte{0xff}, 0x10000)
+	fw := flash[slot : slot+size]
+	for i := range fw {
+		fw[i] = byte(i)
+	}
+	var info bytes.Buffer
+	binary.Write(&info, binary.LittleEndian, FwInfo{
+		Magic:       [3]uint32{fwInfoMagicCommon, fwInfoMagicFwInfo, 0x3002},
+		TotalSize:   uint32(binary.Size(FwInfo{})),
+		Size:        size,
+		Version:     5,
+		Address:     slot,
+		BootAddress: slot,
+		Valid:       fwInfoValidVal,
+	})
+	copy(fw[0x200:], info.Bytes())
+
+	h := sha256.Sum256(fw)
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := FwValidationInfo{
+		Magic:   [3]uint32{fwInfoMagicCommon, fwInfoMagicValidation, 0x3002},
+		Address: slot,
+		Hash:    h,
+	}
+	copy(v.PublicKey[:], pk)
+	r.FillBytes(v.Signature[:32])
+	s.FillBytes(v.Signature[32:])
+	var val bytes.Buffer
+	binary.Write(&val, binary.LittleEndian, v)
+	// Padding between the image and its validation info is skipped.
+	copy(flash[slot+size+0x10:], val.Bytes())
+
+	other := bytes.Repeat([]byte{0x42}, 64)
+	p, err := ParseProvisionData(buildTestProvision(slot, 0x20000, [][]byte{other, pk}, []bool{false, true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.S0Address != slot || len(p.Keys) != 2 || p.Keys[0].Valid || !p.Keys[1].Valid {
+		t.Fatalf("provision data = %+v", p)
+	}
+	if len(p.Counters) != 1 || p.Counters[0].Type != 1 || p.Counters[0].Value() != 2 {
+		t.Errorf("counters = %+v", p.Counters)
+	}
+
+	got, err := p.VerifySlot(bytes.NewReader(flash), slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != 5 {
+		t.Errorf("fw_info version = %d, want 5", got.Version)
+	}
+	if i, err := p.KeyIndex(pk); i != 1 || err != nil {
+		t.Errorf("KeyIndex = %d, %v", i, err)
+	}
+	if _, err := p.KeyIndex(other); err == nil {
+		t.Error("revoked key was accepted")
+	}
+	s0, s1 := p.VerifyImages(bytes.NewReader(flash))
+	if s0 != nil || s1 == nil {
+		t.Errorf("VerifyImages = %v, %v", s0, s1)
+	}
+
+	tampered := bytes.Clone(flash)
+	tampered[slot+0x800] ^= 1
+	if _, err := p.VerifySlot(bytes.NewReader(tampered), slot); err == nil {
+		t.Error("modified image verified")
+	}
+	revoked, err := ParseProvisionData(buildTestProvision(slot, 0, [][]byte{pk}, []bool{false}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := revoked.VerifySlot(bytes.NewReader(flash), slot); err == nil {
+		t.Error("image signed with a revoked key verified")
+	}
+	if _, err := ParseProvisionData(bytes.Repeat([]byte{0xff}, 0x40)); err == nil {
+		t.Error("erased provisioning data was parsed")
+	}
+}
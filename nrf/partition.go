@@ -0,0 +1,231 @@
+package nrf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Partition is a named flash region.
+type Partition struct {
+	Name    string
+	Address uint32
+	Size    uint32
+	// Region is the Partition Manager region, e.g. flash_primary.
+	Region string
+}
+
+// End returns the address just past the partition.
+func (p *Partition) End() uint32 {
+	return p.Address + p.Size
+}
+
+// PartitionMap is a flash partition layout sorted by address.
+type PartitionMap struct {
+	Partitions []*Partition
+}
+
+// Partition names used by Partition Manager for devicetree node labels.
+var dtsPartitionNames = map[string]string{
+	"boot_partition":    "mcuboot",
+	"slot0_partition":   "mcuboot_primary",
+	"slot1_partition":   "mcuboot_secondary",
+	"slot2_partition":   "mcuboot_primary_1",
+	"slot3_partition":   "mcuboot_secondary_1",
+	"scratch_partition": "mcuboot_scratch",
+	"storage_partition": "settings_storage",
+	"mcuboot":           "mcuboot",
+	"image-0":           "mcuboot_primary",
+	"image-1":           "mcuboot_secondary",
+	"image-2":           "mcuboot_primary_1",
+	"image-3":           "mcuboot_secondary_1",
+	"image-scratch":     "mcuboot_scratch",
+	"storage":           "settings_storage",
+}
+
+// LoadPartitions loads partitions.yml or a devicetree source such as
+// zephyr.dts, depending on the file extension.
+func LoadPartitions(name string) (*PartitionMap, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(name) {
+	case ".yml", ".yaml":
+		return LoadPartitionManager(bytes.NewReader(b))
+	case ".dts", ".dtsi":
+		return LoadDevicetreePartitions(bytes.NewReader(b))
+	}
+	return nil, errors.New("unknown partition file type")
+}
+
+type pmPartition struct {
+	Address uint32 `yaml:"address"`
+	Size    uint32 `yaml:"size"`
+	Region  string `yaml:"region"`
+}
+
+// LoadPartitionManager loads the partitions.yml emitted by Partition Manager
+// in nRF Connect SDK builds.
+func LoadPartitionManager(r io.Reader) (*PartitionMap, error) {
+	var parts map[string]pmPartition
+	if err := yaml.NewDecoder(r).Decode(&parts); err != nil {
+		return nil, err
+	}
+	m := &PartitionMap{}
+	for name, p := range parts {
+		m.Partitions = append(m.Partitions, &Partition{
+			Name:    name,
+			Address: p.Address,
+			Size:    p.Size,
+			Region:  p.Region,
+		})
+	}
+	m.sort()
+	return m, nil
+}
+
+var (
+	dtsPartitionNode = regexp.MustCompile(`(?:([\w-]+):\s*)?partition@([0-9a-fA-F]+)\s*\{([^{}]*)\}`)
+	dtsLabel         = regexp.MustCompile(`\blabel\s*=\s*"([^"]*)"`)
+	dtsReg           = regexp.MustCompile(`\breg\s*=\s*<\s*(\w+)\s+(\w+)\s*>`)
+)
+
+// LoadDevicetreePartitions loads the fixed-partitions nodes of a devicetree
+// source. Partitions are named by their Partition Manager equivalent when
+// one exists, otherwise by their label property or node label.
+func LoadDevicetreePartitions(r io.Reader) (*PartitionMap, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	m := &PartitionMap{}
+	for _, node := range dtsPartitionNode.FindAllSubmatch(b, -1) {
+		reg := dtsReg.FindSubmatch(node[3])
+		if reg == nil {
+			continue
+		}
+		addr, err := strconv.ParseUint(string(reg[1]), 0, 32)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseUint(string(reg[2]), 0, 32)
+		if err != nil {
+			return nil, err
+		}
+		name := string(node[1])
+		if label := dtsLabel.FindSubmatch(node[3]); label != nil {
+			name = string(label[1])
+		}
+		if pm, ok := dtsPartitionNames[name]; ok {
+			name = pm
+		} else if pm, ok := dtsPartitionNames[string(node[1])]; ok {
+			name = pm
+		}
+		if name == "" {
+			name = "partition@" + string(node[2])
+		}
+		m.Partitions = append(m.Partitions, &Partition{
+			Name:    name,
+			Address: uint32(addr),
+			Size:    uint32(size),
+		})
+	}
+	if len(m.Partitions) == 0 {
+		return nil, errors.New("no fixed partitions found")
+	}
+	m.sort()
+	return m, nil
+}
+
+func (m *PartitionMap) sort() {
+	sort.SliceStable(m.Partitions, func(i, j int) bool {
+		a, b := m.Partitions[i], m.Partitions[j]
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return a.Name < b.Name
+	})
+}
+
+// Partition returns the partition with the given name.
+func (m *PartitionMap) Partition(name string) (*Partition, error) {
+	for _, p := range m.Partitions {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("partition %q not found", name)
+}
+
+// mcuBootImageID returns the MCUboot image number of a slot partition.
+func mcuBootImageID(name string) (int, bool) {
+	for _, prefix := range []string{"mcuboot_primary", "mcuboot_secondary"} {
+		if name == prefix {
+			return 0, true
+		}
+		if s, ok := strings.CutPrefix(name, prefix+"_"); ok {
+			id, err := strconv.Atoi(s)
+			return id, err == nil
+		}
+	}
+	return 0, false
+}
+
+// AssignImageIDs sets the ImageID of every image from the slot partition it
+// is stored in and checks the dependencies. Offsets are matched against
+// partitions in the internal flash only; other images get UnknownImageID.
+func (m *PartitionMap) AssignImageIDs(images []*MCUBootImage) error {
+	for _, img := range images {
+		img.ImageID = UnknownImageID
+		for _, p := range m.Partitions {
+			if p.Region != "" && p.Region != "flash_primary" {
+				continue
+			}
+			if img.Offset < int64(p.Address) || img.Offset >= int64(p.End()) {
+				continue
+			}
+			if id, ok := mcuBootImageID(p.Name); ok {
+				img.ImageID = id
+				break
+			}
+		}
+	}
+	return CheckDependencies(images)
+}
+
+// OpenMCUBootPartition reads the image stored in the named slot partition.
+func OpenMCUBootPartition(r io.ReaderAt, m *PartitionMap, name string) (*MCUBoot, error) {
+	p, err := m.Partition(name)
+	if err != nil {
+		return nil, err
+	}
+	sr := io.NewSectionReader(r, int64(p.Address), int64(p.Size))
+	header, err := readMCUBootImgHeader(sr, 0, int64(p.Size))
+	if err != nil {
+		return nil, err
+	}
+	return &MCUBoot{r: sr, header: header}, nil
+}
+
+// ExtractPartition returns the contents of the named partition.
+func (f *Firmware) ExtractPartition(m *PartitionMap, name string) ([]byte, error) {
+	p, err := m.Partition(name)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, p.Size)
+	if _, err := f.r.ReadAt(out, int64(p.Address)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,132 @@
+package nrf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testDts = `
+&flash0 {
+	partitions {
+		compatible = "fixed-partitions";
+		#address-cells = <1>;
+		#size-cells = <1>;
+
+		boot_partition: partition@0 {
+			label = "mcuboot";
+			reg = <0x00000000 0xc000>;
+		};
+		slot0_partition: partition@c000 {
+			label = "image-0";
+			reg = <0x0000c000 0x32000>;
+		};
+		slot1_partition: partition@3e000 {
+			reg = <0x0003e000 0x32000>;
+		};
+		partition@70000 {
+			label = "logs";
+			reg = <0x00070000 0xa000>;
+		};
+		storage_partition: partition@7a000 {
+			label = "storage";
+			reg = <0x0007a000 0x00006000>;
+		};
+	};
+};
+`
+
+func TestLoadDevicetreePartitions(t *testing.T) {
+	m, err := LoadDevicetreePartitions(strings.NewReader(testDts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Partition{
+		{Name: "mcuboot", Address: 0, Size: 0xc000},
+		{Name: "mcuboot_primary", Address: 0xc000, Size: 0x32000},
+		{Name: "mcuboot_secondary", Address: 0x3e000, Size: 0x32000},
+		{Name: "logs", Address: 0x70000, Size: 0xa000},
+		{Name: "settings_storage", Address: 0x7a000, Size: 0x6000},
+	}
+	if len(m.Partitions) != len(want) {
+		t.Fatalf("got %d partitions, want %d", len(m.Partitions), len(want))
+	}
+	for i, w := range want {
+		if *m.Partitions[i] != w {
+			t.Errorf("partition %d = %+v, want %+v", i, *m.Partitions[i], w)
+		}
+	}
+	if _, err := LoadDevicetreePartitions(strings.NewReader("/ { };")); err == nil {
+		t.Error("a devicetree without partitions was accepted")
+	}
+}
+
+func TestLoadPartitionManager(t *testing.T) {
+	m, err := LoadPartitionManager(strings.NewReader(`
+mcuboot_secondary:
+  address: 0x0
+  size: 0x40000
+  region: external_flash
+mcuboot_primary:
+  address: 0xc000
+  size: 0x40000
+  region: flash_primary
+mcuboot:
+  address: 0x0
+  size: 0xc000
+  region: flash_primary
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range m.Partitions {
+		names = append(names, p.Name)
+	}
+	// Sorted by address, then by name.
+	if got := strings.Join(names, ","); got != "mcuboot,mcuboot_secondary,mcuboot_primary" {
+		t.Errorf("partitions = %s", got)
+	}
+	p, err := m.Partition("mcuboot_primary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.End() != 0x4c000 || p.Region != "flash_primary" {
+		t.Errorf("mcuboot_primary = %+v", *p)
+	}
+	if _, err := m.Partition("tfm"); err == nil {
+		t.Error("missing partition was found")
+	}
+
+	img := buildTestImage([]byte{1, 2, 3, 4}, nil, []testTLV{{ImageTLVSHA256, make([]byte, 32)}})
+	flash := bytes.Repeat([]byte{0xff}, 0x20000)
+	copy(flash[0xc000:], img)
+	b, err := OpenMCUBootPartition(bytes.NewReader(flash), m, "mcuboot_primary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Header().ImgSize != 4 {
+		t.Errorf("image size = %d, want 4", b.Header().ImgSize)
+	}
+}
+
+func TestMCUBootImageID(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		id   int
+		ok   bool
+	}{
+		{"mcuboot_primary", 0, true},
+		{"mcuboot_secondary", 0, true},
+		{"mcuboot_primary_1", 1, true},
+		{"mcuboot_secondary_2", 2, true},
+		{"mcuboot_primary_app", 0, false},
+		{"mcuboot_scratch", 0, false},
+		{"app", 0, false},
+	} {
+		id, ok := mcuBootImageID(tt.name)
+		if id != tt.id || ok != tt.ok {
+			t.Errorf("mcuBootImageID(%q) = %d, %v, want %d, %v", tt.name, id, ok, tt.id, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package nrf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+const scanChunkSize = 0x10000
+
+// scanMagic calls fn with the offset of every occurrence of magic in the
+// first size bytes of r. Only one chunk is held in memory at a time.
+// Scanning stops when fn returns false.
+func scanMagic(r io.ReaderAt, size int64, magic []byte, fn func(off int64) bool) error {
+	if len(magic) == 0 {
+		return errors.New("empty magic")
+	}
+	overlap := len(magic) - 1
+	buf := make([]byte, scanChunkSize+overlap)
+	for base := int64(0); base < size; base += scanChunkSize {
+		want := int(min(int64(len(buf)), size-base))
+		n, err := r.ReadAt(buf[:want], base)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		chunk := buf[:n]
+		idx := 0
+		for {
+			offset := bytes.Index(chunk[idx:], magic)
+			if offset == -1 {
+				break
+			}
+			// Matches starting in the overlap belong to the next chunk.
+			if idx+offset >= scanChunkSize {
+				break
+			}
+			if !fn(base + int64(idx+offset)) {
+				return nil
+			}
+			idx += offset + 1
+		}
+		if n < want {
+			break
+		}
+	}
+	return nil
+}
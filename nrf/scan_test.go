@@ -0,0 +1,78 @@
+package nrf
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestScanMagic(t *testing.T) {
+	magic := []byte{0x3d, 0xb8, 0xf3, 0x96}
+	b := bytes.Repeat([]byte{0xff}, 3*scanChunkSize)
+	// One match straddles the first chunk boundary.
+	want := []int64{0x10, scanChunkSize - 2, 2*scanChunkSize + 0x100}
+	for _, off := range want {
+		copy(b[off:], magic)
+	}
+	var got []int64
+	err := scanMagic(bytes.NewReader(b), int64(len(b)), magic, func(off int64) bool {
+		got = append(got, off)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("offsets = %#x, want %#x", got, want)
+	}
+}
+
+func TestDetectMCUBootRawFile(t *testing.T) {
+	key := generateTestKey(t, "P-256")
+	signed, err := SignMCUBootImage(testImage, privateKeyPEM(t, key), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A flash dump with a bootloader in front of two images.
+	dump := bytes.Repeat([]byte{0xff}, 0x20000)
+	copy(dump[0xc000:], signed)
+	copy(dump[0x14000:], signed)
+	name := filepath.Join(t.TempDir(), "dump.bin")
+	if err := os.WriteFile(name, dump, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := DetectMCUBoot(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.base != 0xc000 {
+		t.Errorf("image found at %#x, want 0xc000", b.base)
+	}
+	if err := b.Verify(publicKeyPEM(t, key.Public())); err != nil {
+		t.Error(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Error(err)
+	}
+
+	set, err := DetectMCUBootImages(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Images) != 2 {
+		t.Fatalf("found %d images, want 2", len(set.Images))
+	}
+	// Images of a set do not own the file.
+	if err := set.Images[0].Close(); err != nil {
+		t.Error(err)
+	}
+	if err := set.Images[1].Verify(publicKeyPEM(t, key.Public())); err != nil {
+		t.Errorf("image unusable after closing another image of the set: %v", err)
+	}
+	if err := set.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -3,6 +3,7 @@ package nrf
 import (
 	"archive/zip"
 	"bytes"
+	_ "embed"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -11,33 +12,14 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 )
 
-func DetectSDKVersion(r io.ReaderAt) (string, error) {
-	sig, err := generateSignature(r)
-	if err != nil {
-		return "", err
-	}
-	enc := hex.EncodeToString(sig)
-	s, err := readJson("nrf/sig/signature.json")
-	if err != nil {
-		return "", err
-	}
-	for _, signature := range s.Signatures {
-		for _, hash := range signature.Hashes {
-			if enc == hash.Signature {
-				fmt.Println("found signature:", hash.Signature)
-				return signature.SdkVersion, nil
-			}
-		}
-	}
-	return "", errors.New("no SDK version detected")
-}
-
 func generateSignature(r io.ReaderAt) ([]byte, error) {
-	out := make([]byte, 0x2710)
-	_, err := r.ReadAt(out, 0x1000)
+	out := make([]byte, softDeviceSigSize)
+	_, err := r.ReadAt(out, softDeviceStart)
 	if err != nil {
 		return nil, err
 	}
@@ -51,128 +33,260 @@ type SDKSignatures struct {
 type Hash struct {
 	SoftDevice string `json:"softDevice"`
 	Signature  string `json:"signature"`
+	Version    string `json:"version,omitempty"`
+	FWID       uint16 `json:"fwid,omitempty"`
+	// Blocks are the SHA256 of each 4 KiB block of the SoftDevice.
+	Blocks []string `json:"blocks,omitempty"`
 }
 type Signatures struct {
 	SdkVersion string `json:"sdkVersion"`
 	Hashes     []Hash `json:"hashes"`
 }
 
-func readJson(name string) (*SDKSignatures, error) {
+//go:embed sig/signature.json
+var defaultSignatures []byte
+
+// DefaultSignatures returns a copy of the signature database bundled with
+// go-nrf.
+func DefaultSignatures() (*SDKSignatures, error) {
+	return ReadSignatures(bytes.NewReader(defaultSignatures))
+}
+
+// ReadSignatures decodes a signature database.
+func ReadSignatures(r io.Reader) (*SDKSignatures, error) {
+	var s SDKSignatures
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// LoadSignatures reads a signature database from a JSON file.
+func LoadSignatures(name string) (*SDKSignatures, error) {
 	f, err := os.Open(name)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	var s SDKSignatures
-	decoder := json.NewDecoder(f)
-	if err := decoder.Decode(&s); err != nil {
+	return ReadSignatures(f)
+}
+
+// LoadSignaturesWith returns the bundled database merged with the
+// databases at the given paths.
+func LoadSignaturesWith(names ...string) (*SDKSignatures, error) {
+	s, err := DefaultSignatures()
+	if err != nil {
 		return nil, err
 	}
-	return &s, nil
+	for _, name := range names {
+		o, err := LoadSignatures(name)
+		if err != nil {
+			return nil, err
+		}
+		s.Merge(o)
+	}
+	return s, nil
 }
 
-func writeJson(version string, h []Hash) error {
-	s, err := readJson("nrf/sig/signature.json")
-	if err != nil {
-		return err
+// Add records the SoftDevice hashes of an SDK version. Hashes of a
+// SoftDevice already known for that version are replaced.
+func (s *SDKSignatures) Add(version string, hashes ...Hash) {
+	i := slices.IndexFunc(s.Signatures, func(sig Signatures) bool {
+		return sig.SdkVersion == version
+	})
+	if i < 0 {
+		s.Signatures = append(s.Signatures, Signatures{SdkVersion: version})
+		i = len(s.Signatures) - 1
+	}
+	sig := &s.Signatures[i]
+	for _, h := range hashes {
+		j := slices.IndexFunc(sig.Hashes, func(o Hash) bool {
+			return o.SoftDevice == h.SoftDevice
+		})
+		if j < 0 {
+			sig.Hashes = append(sig.Hashes, h)
+		} else {
+			sig.Hashes[j] = h
+		}
+	}
+}
+
+// Merge adds every entry of o to s.
+func (s *SDKSignatures) Merge(o *SDKSignatures) {
+	for _, sig := range o.Signatures {
+		s.Add(sig.SdkVersion, sig.Hashes...)
 	}
-	var ss Signatures
-	ss.SdkVersion = version
-	ss.Hashes = h
-	s.Signatures = append(s.Signatures, ss)
-	b, err := json.MarshalIndent(&s, "", "  ")
+}
+
+// WriteTo writes the database as indented JSON.
+func (s *SDKSignatures) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return os.WriteFile("nrf/sig/signature.json", b, 0644)
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
 }
 
-func GenSignatureFromSDK(name, version string) ([]Hash, error) {
-	temp, err := os.MkdirTemp("", "github.com/q0jt/go-nrf")
+// Save writes the database to a JSON file.
+func (s *SDKSignatures) Save(name string) error {
+	f, err := os.Create(name)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer os.Remove(temp)
+	if _, err := s.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// GenSignatureFromSDK hashes the SoftDevices of an nRF5 SDK and returns
+// them as a database the caller can merge or save. name is an SDK zip or
+// extracted directory, a SoftDevice zip or a sXXX_nrf52_x.y.z_softdevice.hex
+// file. Nested zips are read in memory.
+func GenSignatureFromSDK(name, version string) (*SDKSignatures, error) {
+	return GenSignatureFromFiles(version, name)
+}
+
+// GenSignatureFromFiles is GenSignatureFromSDK for several inputs. When
+// version is empty the SDK versions are taken from the SoftDevice FWID.
+func GenSignatureFromFiles(version string, names ...string) (*SDKSignatures, error) {
 	p := newSDKParser()
-	if err := p.expandZipFile(name, temp); err != nil {
-		return nil, err
+	for _, name := range names {
+		if err := p.parsePath(name); err != nil {
+			return nil, err
+		}
 	}
-	var hashes []Hash
-	for arch, hash := range p.signatures {
-		hashes = append(hashes, Hash{
-			SoftDevice: arch,
-			Signature:  hash,
-		})
+	if len(p.signatures) == 0 {
+		return nil, errors.New("no softdevice hex file found")
 	}
-	if err := writeJson(version, hashes); err != nil {
-		return nil, err
+	s := &SDKSignatures{}
+	keys := make([]string, 0, len(p.signatures))
+	for key := range p.signatures {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		hash := p.signatures[key]
+		if version != "" {
+			s.Add(version, hash)
+			continue
+		}
+		rel, ok := softDeviceFWIDs[hash.FWID]
+		if !ok || len(rel.sdks) == 0 {
+			return nil, fmt.Errorf("sdk version of %s %s is unknown", hash.SoftDevice, hash.Version)
+		}
+		for _, v := range rel.sdks {
+			s.Add(v, hash)
+		}
+	}
+	return s, nil
+}
+
+var softDeviceFileName = regexp.MustCompile(`(?i)^(s\d{3})_(nrf5\d*)_(\d+\.\d+\.\d+(?:-[0-9a-z.]+)?)_softdevice\.hex$`)
+
+// ParseSoftDeviceFileName splits a name like s140_nrf52_7.2.0_softdevice.hex
+// into the SoftDevice, chip family and version.
+func ParseSoftDeviceFileName(name string) (sd, family, version string, ok bool) {
+	m := softDeviceFileName.FindStringSubmatch(filepath.Base(name))
+	if m == nil {
+		return "", "", "", false
 	}
-	return hashes, nil
+	return strings.ToUpper(m[1]), strings.ToLower(m[2]), m[3], true
 }
 
 type sdkParser struct {
-	signatures map[string]string
+	// signatures are keyed by SoftDevice and version.
+	signatures map[string]Hash
 }
 
 func newSDKParser() *sdkParser {
 	return &sdkParser{
-		signatures: map[string]string{},
+		signatures: map[string]Hash{},
 	}
 }
 
-func (p *sdkParser) setSignatures(arch, hash string) {
-	arch = strings.Split(arch, "_")[0]
-	arch = strings.ToUpper(arch)
-	p.signatures[arch] = hash
-}
-
-func (p *sdkParser) expandZipFile(name, temp string) error {
-	r, err := zip.OpenReader(name)
+func (p *sdkParser) parsePath(name string) error {
+	st, err := os.Stat(name)
 	if err != nil {
 		return err
 	}
-	defer r.Close()
-	for _, file := range r.File {
-		fn := file.Name
-		ext := filepath.Ext(fn)
-		if ext != ".zip" {
-			if isHexFile(ext, fn) {
-				b, err := fs.ReadFile(r, fn)
-				if err != nil {
-					return err
-				}
-				bin, err := HexFileToBinary(b)
-				if err != nil {
-					return err
-				}
-				hash, err := genSignatureFromSDK(bin)
-				if err != nil {
-					return err
-				}
-				p.setSignatures(fn, hex.EncodeToString(hash))
-			}
-			continue
-		}
-		b, err := fs.ReadFile(r, fn)
+	if st.IsDir() {
+		return p.parseFS(os.DirFS(name))
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return p.parseFile(name, b)
+}
+
+func (p *sdkParser) parseFS(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if err := writeTmpFile(temp, fn, b); err != nil {
-			return err
+		if d.IsDir() || !isSDKFile(path) {
+			return nil
 		}
-		if err := p.expandZipFile(filepath.Join(temp, fn), temp); err != nil {
+		b, err := fs.ReadFile(fsys, path)
+		if err != nil {
 			return err
 		}
+		return p.parseFile(path, b)
+	})
+}
+
+func isSDKFile(name string) bool {
+	if strings.EqualFold(filepath.Ext(name), ".zip") {
+		return true
 	}
-	return nil
+	_, _, _, ok := ParseSoftDeviceFileName(name)
+	return ok
 }
 
-func isHexFile(ext, name string) bool {
-	isHex := ext == ".hex"
-	return isHex && !strings.Contains(name, "nRF5_SDK")
+func (p *sdkParser) parseFile(name string, b []byte) error {
+	if strings.EqualFold(filepath.Ext(name), ".zip") {
+		r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return p.parseFS(r)
+	}
+	sd, _, version, ok := ParseSoftDeviceFileName(name)
+	if !ok {
+		return fmt.Errorf("%s: not a softdevice hex file", name)
+	}
+	bin, err := HexFileToBinary(b)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	hash, err := genSignatureFromSDK(bin)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	hash.SoftDevice = sd
+	if hash.Version == "" {
+		hash.Version = version
+	}
+	p.signatures[sd+"_"+hash.Version] = hash
+	return nil
 }
 
-func genSignatureFromSDK(b []byte) ([]byte, error) {
+func genSignatureFromSDK(b []byte) (Hash, error) {
 	r := bytes.NewReader(b)
-	return generateSignature(r)
+	sig, err := generateSignature(r)
+	if err != nil {
+		return Hash{}, err
+	}
+	hash := Hash{Signature: hex.EncodeToString(sig)}
+	var end uint32
+	if info, err := ReadSoftDeviceInfo(r); err == nil {
+		hash.FWID = info.FWID
+		hash.Version = info.VersionString()
+		end = info.End
+	}
+	hash.Blocks = softDeviceBlocks(r, end)
+	return hash, nil
 }
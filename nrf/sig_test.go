@@ -0,0 +1,179 @@
+package nrf
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestDefaultSignatures(t *testing.T) {
+	s, err := DefaultSignatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Signatures) == 0 {
+		t.Fatal("the bundled database is empty")
+	}
+	for _, sig := range s.Signatures {
+		for _, h := range sig.Hashes {
+			if h.SoftDevice == "" || len(h.Signature) != 64 {
+				t.Errorf("SDK %s: invalid entry %+v", sig.SdkVersion, h)
+			}
+		}
+	}
+	// Every call returns a copy.
+	s.Signatures = nil
+	if s, _ := DefaultSignatures(); len(s.Signatures) == 0 {
+		t.Error("modifying the returned database changed the bundled one")
+	}
+}
+
+func TestSDKSignaturesMerge(t *testing.T) {
+	s := &SDKSignatures{}
+	s.Add("17.1.0", Hash{SoftDevice: "S140", Signature: "a1", Version: "7.2.0"})
+	s.Add("17.1.0", Hash{SoftDevice: "S132", Signature: "b1", Version: "7.2.0"})
+	// A SoftDevice already known for the SDK version is replaced.
+	s.Add("17.1.0", Hash{SoftDevice: "S140", Signature: "a2", Version: "7.2.0"})
+
+	o := &SDKSignatures{Signatures: []Signatures{
+		{SdkVersion: "17.1.0", Hashes: []Hash{{SoftDevice: "S132", Signature: "b2", Version: "7.2.0"}}},
+		{SdkVersion: "15.3.0", Hashes: []Hash{{SoftDevice: "S140", Signature: "c1", Version: "6.1.1"}}},
+	}}
+	s.Merge(o)
+	want := &SDKSignatures{Signatures: []Signatures{
+		{SdkVersion: "17.1.0", Hashes: []Hash{
+			{SoftDevice: "S140", Signature: "a2", Version: "7.2.0"},
+			{SoftDevice: "S132", Signature: "b2", Version: "7.2.0"},
+		}},
+		{SdkVersion: "15.3.0", Hashes: []Hash{{SoftDevice: "S140", Signature: "c1", Version: "6.1.1"}}},
+	}}
+	if !reflect.DeepEqual(s, want) {
+		t.Fatalf("merged database = %+v, want %+v", s, want)
+	}
+
+	name := filepath.Join(t.TempDir(), "signature.json")
+	if err := s.Save(name); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSignatures(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Errorf("loaded database = %+v, want %+v", loaded, want)
+	}
+	all, err := LoadSignaturesWith(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, _ := DefaultSignatures()
+	if len(all.Signatures) < len(def.Signatures) {
+		t.Error("LoadSignaturesWith dropped bundled entries")
+	}
+}
+
+func TestParseSoftDeviceFileName(t *testing.T) {
+	for _, tt := range []struct {
+		name                string
+		sd, family, version string
+		ok                  bool
+	}{
+		{"s140_nrf52_7.2.0_softdevice.hex", "S140", "nrf52", "7.2.0", true},
+		{"components/softdevice/s132/hex/s132_nrf52_6.1.1_softdevice.hex", "S132", "nrf52", "6.1.1", true},
+		{"s130_nrf51_2.0.1_softdevice.hex", "S130", "nrf51", "2.0.1", true},
+		{"S140_NRF52_6.0.0-6.alpha_softdevice.hex", "S140", "nrf52", "6.0.0-6.alpha", true},
+		{"s112_nrf52810_5.1.0_softdevice.hex", "S112", "nrf52810", "5.1.0", true},
+		{"s140_nrf52_7.2.0_API.zip", "", "", "", false},
+		{"s140_nrf52_7.2.0_softdevice.bin", "", "", "", false},
+		{"s140_nrf52_7.2_softdevice.hex", "", "", "", false},
+	} {
+		sd, family, version, ok := ParseSoftDeviceFileName(tt.name)
+		if sd != tt.sd || family != tt.family || version != tt.version || ok != tt.ok {
+			t.Errorf("ParseSoftDeviceFileName(%q) = %q, %q, %q, %v", tt.name, sd, family, version, ok)
+		}
+	}
+}
+
+// softDeviceHex returns a SoftDevice hex file with an info struct.
+func softDeviceHex(t *testing.T, fwid uint16, id, version uint32) []byte {
+	t.Helper()
+	b := testSoftDevice(0x6000)
+	b[0] = byte(fwid) // differ between SoftDevices
+	setSoftDeviceInfo(b, 0x6000, fwid, id, version)
+	f := NewFlashImage()
+	if err := f.AddBinary(softDeviceStart, b[softDeviceStart:]); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := f.WriteHex(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeTestZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, b := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(b)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenSignatureFromNestedZips(t *testing.T) {
+	// Two SoftDevice zips with the same name in different directories of
+	// an SDK zip, as in the nRF5 SDK components tree.
+	s140 := writeTestZip(t, map[string][]byte{
+		"s140_nrf52_7.2.0_softdevice.hex": softDeviceHex(t, 0x100, 140, 7002000),
+	})
+	s132 := writeTestZip(t, map[string][]byte{
+		"s132_nrf52_6.1.1_softdevice.hex": softDeviceHex(t, 0xB7, 132, 6001001),
+	})
+	sdk := writeTestZip(t, map[string][]byte{
+		"components/softdevice/s140/hex/softdevice.zip": s140,
+		"components/softdevice/s132/hex/softdevice.zip": s132,
+	})
+	name := filepath.Join(t.TempDir(), "nRF5_SDK.zip")
+	if err := os.WriteFile(name, sdk, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := GenSignatureFromFiles("", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, sig := range s.Signatures {
+		for _, h := range sig.Hashes {
+			got = append(got, sig.SdkVersion+" "+h.SoftDevice+" "+h.Version)
+			if len(h.Blocks) != 5 {
+				t.Errorf("%s %s has %d blocks, want 5", h.SoftDevice, h.Version, len(h.Blocks))
+			}
+		}
+	}
+	slices.Sort(got)
+	want := []string{"15.3.0 S132 6.1.1", "17.0.0 S140 7.2.0", "17.0.2 S140 7.2.0", "17.1.0 S140 7.2.0"}
+	if !slices.Equal(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+
+	s, err = GenSignatureFromSDK(name, "custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Signatures) != 1 || len(s.Signatures[0].Hashes) != 2 {
+		t.Errorf("entries for an explicit SDK version = %+v", s.Signatures)
+	}
+}
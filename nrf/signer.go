@@ -0,0 +1,303 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+
+	"github.com/q0jt/go-nrf/nrf/dfu"
+	"google.golang.org/protobuf/proto"
+)
+
+// SignMCUBootImageWith is SignMCUBootImage with a signer whose private key
+// may live outside the process, see CommandSigner and PKCS11Signer.
+func SignMCUBootImageWith(img []byte, signer crypto.Signer, opts *ImageOptions) ([]byte, error) {
+	return buildMCUBootImage(img, signer, opts)
+}
+
+// SignInitPacket signs the init command of a DFU packet the way nrfutil
+// does and replaces the packet command with the signed command. P-256
+// signatures are stored little-endian.
+func SignInitPacket(p *dfu.Packet, signer crypto.Signer) error {
+	cmd := p.GetCommand()
+	if cmd == nil {
+		cmd = p.GetSignedCommand().GetCommand()
+	}
+	if cmd.GetInit() == nil {
+		return errors.New("dfu: packet has no init command")
+	}
+	msg, err := proto.Marshal(cmd.Init)
+	if err != nil {
+		return err
+	}
+	var sigType dfu.SignatureType
+	var sig []byte
+	switch pk := signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		if pk.Curve.Params().BitSize != 256 {
+			return &UnsupportedKeyError{ECDSAP256SHA256, pk}
+		}
+		der, err := signer.Sign(rand.Reader, sha256Sum(msg), crypto.SHA256)
+		if err != nil {
+			return err
+		}
+		sig, err = rawECDSASignature(pk, der)
+		if err != nil {
+			return err
+		}
+		slices.Reverse(sig[:0x20])
+		slices.Reverse(sig[0x20:])
+		sigType = dfu.SignatureType_ECDSA_P256_SHA256
+	case ed25519.PublicKey:
+		sig, err = signer.Sign(rand.Reader, msg, crypto.Hash(0))
+		if err != nil {
+			return err
+		}
+		sigType = dfu.SignatureType_ED25519
+	default:
+		return &UnsupportedKeyError{Key: pk}
+	}
+	p.Command = nil
+	p.SignedCommand = &dfu.SignedCommand{
+		Command:       cmd,
+		SignatureType: sigType.Enum(),
+		Signature:     sig,
+	}
+	return nil
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// rawECDSASignature converts an ASN.1 signature to r||s.
+func rawECDSASignature(pk *ecdsa.PublicKey, sig []byte) ([]byte, error) {
+	size := (pk.Curve.Params().BitSize + 7) / 8
+	if len(sig) == 2*size {
+		return sig, nil
+	}
+	var s ecdsaSignature
+	rest, err := asn1.Unmarshal(sig, &s)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after ecdsa signature")
+	}
+	out := make([]byte, 2*size)
+	s.R.FillBytes(out[:size])
+	s.S.FillBytes(out[size:])
+	return out, nil
+}
+
+// asn1ECDSASignature converts a r||s signature to ASN.1, the form
+// crypto.Signer returns.
+func asn1ECDSASignature(pk *ecdsa.PublicKey, sig []byte) ([]byte, error) {
+	size := (pk.Curve.Params().BitSize + 7) / 8
+	if len(sig) != 2*size {
+		return sig, nil
+	}
+	return asn1.Marshal(ecdsaSignature{
+		R: new(big.Int).SetBytes(sig[:size]),
+		S: new(big.Int).SetBytes(sig[size:]),
+	})
+}
+
+// CommandSigner signs with an external program, such as a wrapper around
+// an HSM client. The digest, or the message for Ed25519 keys, is written
+// to stdin and the signature is read from stdout. NRF_SIGN_HASH holds the
+// hash name (empty for Ed25519) and NRF_SIGN_PADDING is "pss" or "pkcs1"
+// for RSA keys. ECDSA signatures may be ASN.1 or raw r||s.
+type CommandSigner struct {
+	PublicKey crypto.PublicKey
+	Path      string
+	Args      []string
+}
+
+// NewCommandSigner returns a signer for the PEM, DER or raw public key.
+func NewCommandSigner(pubKey []byte, path string, args ...string) (*CommandSigner, error) {
+	key, err := parsePublicKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return &CommandSigner{PublicKey: key, Path: path, Args: args}, nil
+}
+
+func (s *CommandSigner) Public() crypto.PublicKey {
+	return s.PublicKey
+}
+
+func (s *CommandSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	cmd := exec.Command(s.Path, s.Args...)
+	cmd.Env = append(os.Environ(), "NRF_SIGN_HASH="+hashName(opts.HashFunc()))
+	if _, ok := s.PublicKey.(*rsa.PublicKey); ok {
+		padding := "pkcs1"
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			padding = "pss"
+		}
+		cmd.Env = append(cmd.Env, "NRF_SIGN_PADDING="+padding)
+	}
+	cmd.Stdin = bytes.NewReader(digest)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	sig, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("sign command: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if len(sig) == 0 {
+		return nil, errors.New("sign command: empty signature")
+	}
+	if pk, ok := s.PublicKey.(*ecdsa.PublicKey); ok {
+		return asn1ECDSASignature(pk, sig)
+	}
+	return sig, nil
+}
+
+func hashName(h crypto.Hash) string {
+	if h == 0 {
+		return ""
+	}
+	return h.String()
+}
+
+// PKCS11Config selects a key in a PKCS#11 token. Keys are used through
+// OpenSC pkcs11-tool 0.23 or later, so the private key never leaves the
+// token. SoftHSM (libsofthsm2.so) can stand in for the production HSM
+// locally.
+type PKCS11Config struct {
+	// Module is the PKCS#11 library, e.g. /usr/lib/softhsm/libsofthsm2.so.
+	Module     string
+	TokenLabel string
+	// PIN is passed to the tool through the environment, never on the
+	// command line.
+	PIN string
+	// KeyID is the hex CKA_ID of the key pair, KeyLabel its CKA_LABEL.
+	KeyID    string
+	KeyLabel string
+	// Tool defaults to pkcs11-tool from PATH.
+	Tool string
+}
+
+// PKCS11Signer signs with a key held in a PKCS#11 token.
+type PKCS11Signer struct {
+	cfg PKCS11Config
+	pub crypto.PublicKey
+}
+
+// NewPKCS11Signer reads the public key of the configured key pair.
+func NewPKCS11Signer(cfg PKCS11Config) (*PKCS11Signer, error) {
+	if cfg.Module == "" {
+		return nil, errors.New("pkcs11: module is required")
+	}
+	if cfg.KeyID == "" && cfg.KeyLabel == "" {
+		return nil, errors.New("pkcs11: key id or label is required")
+	}
+	if cfg.Tool == "" {
+		cfg.Tool = "pkcs11-tool"
+	}
+	s := &PKCS11Signer{cfg: cfg}
+	der, err := s.run(nil, "--read-object", "--type", "pubkey")
+	if err != nil {
+		return nil, err
+	}
+	if s.pub, err = parsePublicKey(der); err != nil {
+		return nil, fmt.Errorf("pkcs11: %w", err)
+	}
+	return s, nil
+}
+
+func (s *PKCS11Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// digestInfoPrefix is the DER DigestInfo header RSA PKCS#1 v1.5 signs.
+var digestInfoPrefix = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+var pkcs11HashNames = map[crypto.Hash]string{
+	crypto.SHA256: "SHA256",
+	crypto.SHA384: "SHA384",
+	crypto.SHA512: "SHA512",
+}
+
+func (s *PKCS11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	h := opts.HashFunc()
+	switch pk := s.pub.(type) {
+	case *ecdsa.PublicKey:
+		sig, err := s.run(digest, "--sign", "--mechanism", "ECDSA", "--signature-format", "openssl")
+		if err != nil {
+			return nil, err
+		}
+		return asn1ECDSASignature(pk, sig)
+	case ed25519.PublicKey:
+		return s.run(digest, "--sign", "--mechanism", "EDDSA")
+	case *rsa.PublicKey:
+		name, ok := pkcs11HashNames[h]
+		if !ok {
+			return nil, fmt.Errorf("pkcs11: unsupported hash %v", h)
+		}
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			return s.run(digest, "--sign", "--mechanism", "RSA-PKCS-PSS",
+				"--hash-algorithm", name, "--mgf", "MGF1-"+name)
+		}
+		msg := append(slices.Clone(digestInfoPrefix[h]), digest...)
+		return s.run(msg, "--sign", "--mechanism", "RSA-PKCS")
+	}
+	return nil, &UnsupportedKeyError{Key: s.pub}
+}
+
+const pkcs11PINEnv = "NRF_PKCS11_PIN"
+
+// run invokes the tool on the configured key. in is passed as the input
+// file when not nil and the output file is returned.
+func (s *PKCS11Signer) run(in []byte, args ...string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "nrf-pkcs11")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	args = append(args, "--module", s.cfg.Module, "--output-file", out)
+	if s.cfg.TokenLabel != "" {
+		args = append(args, "--token-label", s.cfg.TokenLabel)
+	}
+	if s.cfg.PIN != "" {
+		args = append(args, "--login", "--pin", "env:"+pkcs11PINEnv)
+	}
+	if s.cfg.KeyID != "" {
+		args = append(args, "--id", s.cfg.KeyID)
+	}
+	if s.cfg.KeyLabel != "" {
+		args = append(args, "--label", s.cfg.KeyLabel)
+	}
+	if in != nil {
+		name := filepath.Join(dir, "in")
+		if err := os.WriteFile(name, in, 0600); err != nil {
+			return nil, err
+		}
+		args = append(args, "--input-file", name)
+	}
+	cmd := exec.Command(s.cfg.Tool, args...)
+	if s.cfg.PIN != "" {
+		cmd.Env = append(os.Environ(), pkcs11PINEnv+"="+s.cfg.PIN)
+	}
+	if b, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pkcs11: %w: %s", err, bytes.TrimSpace(b))
+	}
+	return os.ReadFile(out)
+}
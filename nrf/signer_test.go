@@ -0,0 +1,302 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/q0jt/go-nrf/nrf/dfu"
+	"google.golang.org/protobuf/proto"
+)
+
+// testImage is an unsigned image body.
+var testImage = bytes.Repeat([]byte{0x00, 0x20, 0x00, 0x20, 0xa5, 0x5a, 0x01, 0xfe}, 0x200)
+
+func generateTestKey(t *testing.T, name string) crypto.Signer {
+	t.Helper()
+	var key crypto.Signer
+	var err error
+	switch name {
+	case "P-256":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "P-384":
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "Ed25519":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "RSA-2048":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "RSA-3072":
+		key, err = rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		t.Fatalf("unknown key type %s", name)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func privateKeyPEM(t *testing.T, key any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func publicKeyPEM(t *testing.T, key crypto.PublicKey) []byte {
+	t.Helper()
+	b, err := MarshalPublicKey(key, KeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// verifySigned parses a signed image and verifies it with pub.
+func verifySigned(t *testing.T, signed []byte, pub crypto.PublicKey) *MCUBoot {
+	t.Helper()
+	b, err := NewMCUBoot(bytes.NewReader(signed), int64(len(signed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Verify(publicKeyPEM(t, pub)); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	return b
+}
+
+// TestCommandSignerHelper is the sign command run by TestCommandSigner.
+func TestCommandSignerHelper(t *testing.T) {
+	name := os.Getenv("NRF_TEST_SIGN_KEY")
+	if name == "" {
+		t.Skip("run by TestCommandSigner")
+	}
+	if err := signCommandHelper(name); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func signCommandHelper(name string) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	key, err := parsePrivateKey(b)
+	if err != nil {
+		return err
+	}
+	digest, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	var opts crypto.SignerOpts = crypto.Hash(0)
+	for _, h := range []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		if os.Getenv("NRF_SIGN_HASH") == h.String() {
+			opts = h
+		}
+	}
+	if os.Getenv("NRF_SIGN_PADDING") == "pss" {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: opts.HashFunc()}
+	}
+	sig, err := key.(crypto.Signer).Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(sig)
+	return err
+}
+
+func TestCommandSigner(t *testing.T) {
+	for _, name := range []string{"P-256", "Ed25519", "RSA-2048"} {
+		t.Run(name, func(t *testing.T) {
+			key := generateTestKey(t, name)
+			keyFile := filepath.Join(t.TempDir(), "key.pem")
+			if err := os.WriteFile(keyFile, privateKeyPEM(t, key), 0600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("NRF_TEST_SIGN_KEY", keyFile)
+			signer, err := NewCommandSigner(publicKeyPEM(t, key.Public()), os.Args[0],
+				"-test.run=^TestCommandSignerHelper$")
+			if err != nil {
+				t.Fatal(err)
+			}
+			signed, err := SignMCUBootImageWith(testImage, signer, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifySigned(t, signed, key.Public())
+		})
+	}
+}
+
+// softHSMModule returns the SoftHSM library from SOFTHSM2_MODULE or the
+// usual install locations.
+func softHSMModule() string {
+	if m := os.Getenv("SOFTHSM2_MODULE"); m != "" {
+		return m
+	}
+	for _, m := range []string{
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/lib/aarch64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+		"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+	} {
+		if _, err := os.Stat(m); err == nil {
+			return m
+		}
+	}
+	return ""
+}
+
+func runTool(t *testing.T, name string, args ...string) {
+	t.Helper()
+	if b, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		t.Fatalf("%s: %v: %s", name, err, b)
+	}
+}
+
+func TestPKCS11Signer(t *testing.T) {
+	for _, tool := range []string{"softhsm2-util", "pkcs11-tool"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found", tool)
+		}
+	}
+	module := softHSMModule()
+	if module == "" {
+		t.Skip("libsofthsm2.so not found")
+	}
+	dir := t.TempDir()
+	tokens := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokens, 0700); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := os.WriteFile(conf, []byte("directories.tokendir = "+tokens+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+	const label, pin = "nrf-test", "1234"
+	runTool(t, "softhsm2-util", "--init-token", "--free", "--label", label, "--pin", pin, "--so-pin", "5678")
+
+	for _, tc := range []struct {
+		name, keyType, id string
+	}{
+		{"P-256", "EC:prime256v1", "01"},
+		{"RSA-2048", "rsa:2048", "02"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			runTool(t, "pkcs11-tool", "--module", module, "--token-label", label,
+				"--login", "--pin", pin, "--keypairgen", "--key-type", tc.keyType,
+				"--id", tc.id, "--label", tc.name)
+			signer, err := NewPKCS11Signer(PKCS11Config{
+				Module:     module,
+				TokenLabel: label,
+				PIN:        pin,
+				KeyID:      tc.id,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			signed, err := SignMCUBootImageWith(testImage, signer, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifySigned(t, signed, signer.Public())
+		})
+	}
+}
+
+func testInitPacket() *dfu.Packet {
+	return &dfu.Packet{Command: &dfu.Command{
+		OpCode: dfu.OpCode_INIT.Enum(),
+		Init: &dfu.InitCommand{
+			FwVersion: proto.Uint32(1),
+			HwVersion: proto.Uint32(52),
+			SdReq:     []uint32{0x0101},
+			Type:      dfu.FwType_APPLICATION.Enum(),
+			AppSize:   proto.Uint32(uint32(len(testImage))),
+			Hash: &dfu.Hash{
+				HashType: dfu.HashType_SHA256.Enum(),
+				Hash:     make([]byte, 32),
+			},
+		},
+	}}
+}
+
+func TestSignInitPacket(t *testing.T) {
+	key := generateTestKey(t, "P-256")
+	p := testInitPacket()
+	if err := SignInitPacket(p, key); err != nil {
+		t.Fatal(err)
+	}
+	if p.Command != nil {
+		t.Error("unsigned command was kept")
+	}
+	signed := p.GetSignedCommand()
+	if signed.GetSignatureType() != dfu.SignatureType_ECDSA_P256_SHA256 {
+		t.Errorf("signature type = %v", signed.GetSignatureType())
+	}
+	msg, err := proto.Marshal(signed.GetCommand().GetInit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(msg)
+	sig := signed.GetSignature()
+	if len(sig) != 64 {
+		t.Fatalf("signature is %d bytes, want 64", len(sig))
+	}
+	// The bootloader reads r and s little-endian.
+	r, s := slices.Clone(sig[:32]), slices.Clone(sig[32:])
+	slices.Reverse(r)
+	slices.Reverse(s)
+	pub := key.Public().(*ecdsa.PublicKey)
+	if !ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(r), new(big.Int).SetBytes(s)) {
+		t.Error("signature does not verify as little-endian r and s")
+	}
+
+	// Signing again replaces the signature of the signed command.
+	other := generateTestKey(t, "P-256")
+	if err := SignInitPacket(p, other); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(p.GetSignedCommand().GetSignature(), sig) {
+		t.Error("packet was not signed again")
+	}
+
+	edKey := generateTestKey(t, "Ed25519")
+	p = testInitPacket()
+	if err := SignInitPacket(p, edKey); err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(edKey.Public().(ed25519.PublicKey), msg, p.GetSignedCommand().GetSignature()) {
+		t.Error("ed25519 signature does not verify over the init command")
+	}
+
+	if err := SignInitPacket(testInitPacket(), generateTestKey(t, "P-384")); err == nil {
+		t.Error("signed with a P-384 key")
+	}
+	reset := &dfu.Packet{Command: &dfu.Command{OpCode: dfu.OpCode_RESET.Enum()}}
+	if err := SignInitPacket(reset, key); err == nil {
+		t.Error("signed a packet without an init command")
+	}
+}
@@ -0,0 +1,214 @@
+package smp
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/q0jt/go-nrf/nrf"
+)
+
+// DefaultMTU is the default buffer size of the Zephyr SMP server.
+const DefaultMTU = 384
+
+// Client sends SMP requests over a transport.
+type Client struct {
+	t   Transport
+	seq uint8
+	// MTU bounds the size of a request, including the header.
+	MTU int
+}
+
+func NewClient(t Transport) *Client {
+	return &Client{t: t, MTU: DefaultMTU}
+}
+
+func (c *Client) Close() error {
+	return c.t.Close()
+}
+
+// request sends req and decodes the matching response into rsp.
+func (c *Client) request(op Op, group Group, id uint8, req, res any) error {
+	msg, err := newMessage(op, group, id, req)
+	if err != nil {
+		return err
+	}
+	c.seq++
+	msg.Seq = c.seq
+	b, err := msg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := c.t.Send(b); err != nil {
+		return err
+	}
+	for {
+		b, err := c.t.Recv()
+		if err != nil {
+			return err
+		}
+		var r Message
+		if err := r.UnmarshalBinary(b); err != nil {
+			return err
+		}
+		// Skip stale responses of earlier requests.
+		if r.Seq != msg.Seq || r.Group != group || r.ID != id {
+			continue
+		}
+		if r.Op != op+1 {
+			return fmt.Errorf("smp: unexpected op %d", r.Op)
+		}
+		var rc rsp
+		if err := cbor.Unmarshal(r.Payload, &rc); err != nil {
+			return err
+		}
+		if err := rc.err(group); err != nil {
+			return err
+		}
+		if res == nil {
+			return nil
+		}
+		return cbor.Unmarshal(r.Payload, res)
+	}
+}
+
+type echoReq struct {
+	D string `cbor:"d"`
+}
+
+type echoRsp struct {
+	R string `cbor:"r"`
+}
+
+// Echo returns the string echoed by the device.
+func (c *Client) Echo(s string) (string, error) {
+	var res echoRsp
+	if err := c.request(OpWrite, GroupOS, IDOSEcho, &echoReq{D: s}, &res); err != nil {
+		return "", err
+	}
+	return res.R, nil
+}
+
+// Reset reboots the device.
+func (c *Client) Reset() error {
+	return c.request(OpWrite, GroupOS, IDOSReset, map[string]any{}, nil)
+}
+
+// ImageState is an entry of the image list.
+type ImageState struct {
+	Image     int    `cbor:"image"`
+	Slot      int    `cbor:"slot"`
+	Version   string `cbor:"version"`
+	Hash      []byte `cbor:"hash"`
+	Bootable  bool   `cbor:"bootable"`
+	Pending   bool   `cbor:"pending"`
+	Confirmed bool   `cbor:"confirmed"`
+	Active    bool   `cbor:"active"`
+	Permanent bool   `cbor:"permanent"`
+}
+
+type imageStateRsp struct {
+	Images      []ImageState `cbor:"images"`
+	SplitStatus int          `cbor:"splitStatus,omitempty"`
+}
+
+type imageStateReq struct {
+	Hash    []byte `cbor:"hash,omitempty"`
+	Confirm bool   `cbor:"confirm"`
+}
+
+// ImageList returns the images in the slots of the device.
+func (c *Client) ImageList() ([]ImageState, error) {
+	var res imageStateRsp
+	if err := c.request(OpRead, GroupImage, IDImageState, map[string]any{}, &res); err != nil {
+		return nil, err
+	}
+	return res.Images, nil
+}
+
+func (c *Client) setState(req *imageStateReq) ([]ImageState, error) {
+	var res imageStateRsp
+	if err := c.request(OpWrite, GroupImage, IDImageState, req, &res); err != nil {
+		return nil, err
+	}
+	return res.Images, nil
+}
+
+// Test marks the image with hash pending, so it is booted once on the next
+// reset.
+func (c *Client) Test(hash []byte) ([]ImageState, error) {
+	return c.setState(&imageStateReq{Hash: hash})
+}
+
+// Confirm makes the image with hash permanent. A nil hash confirms the
+// running image.
+func (c *Client) Confirm(hash []byte) ([]ImageState, error) {
+	return c.setState(&imageStateReq{Hash: hash, Confirm: true})
+}
+
+type eraseReq struct {
+	Slot int `cbor:"slot"`
+}
+
+// Erase erases the given slot. MCUboot devices only allow erasing slot 1.
+func (c *Client) Erase(slot int) error {
+	return c.request(OpWrite, GroupImage, IDImageErase, &eraseReq{Slot: slot}, nil)
+}
+
+type uploadReq struct {
+	Image   int    `cbor:"image,omitempty"`
+	Len     int    `cbor:"len,omitempty"`
+	Off     int    `cbor:"off"`
+	SHA     []byte `cbor:"sha,omitempty"`
+	Data    []byte `cbor:"data"`
+	Upgrade bool   `cbor:"upgrade,omitempty"`
+}
+
+type uploadRsp struct {
+	Off int `cbor:"off"`
+}
+
+// uploadOverhead is the size of the header and the CBOR fields of the first
+// upload request, excluding data.
+const uploadOverhead = headerSize + 80
+
+// Upload writes the MCUboot image to the secondary slot of image.
+func (c *Client) Upload(img *nrf.MCUBoot, image int, progress func(off, total int)) error {
+	b, err := img.Raw()
+	if err != nil {
+		return err
+	}
+	return c.UploadBytes(b, image, progress)
+}
+
+// UploadBytes writes a complete image file to the secondary slot of image.
+func (c *Client) UploadBytes(b []byte, image int, progress func(off, total int)) error {
+	chunk := c.MTU - uploadOverhead
+	if chunk <= 0 {
+		return errors.New("smp: mtu is too small")
+	}
+	sum := sha256.Sum256(b)
+	off := 0
+	for off < len(b) {
+		end := min(off+chunk, len(b))
+		req := &uploadReq{Off: off, Data: b[off:end]}
+		if off == 0 {
+			req.Image = image
+			req.Len = len(b)
+			req.SHA = sum[:]
+		}
+		var res uploadRsp
+		if err := c.request(OpWrite, GroupImage, IDImageUpload, req, &res); err != nil {
+			return err
+		}
+		if res.Off <= off || res.Off > len(b) {
+			return fmt.Errorf("smp: invalid upload offset %d", res.Off)
+		}
+		off = res.Off
+		if progress != nil {
+			progress(off, len(b))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package smp
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/q0jt/go-nrf/nrf"
+)
+
+func signTestImage(t *testing.T, size int, ver nrf.ImgVersion) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, size)
+	rand.Read(body)
+	img, err := nrf.SignMCUBootImage(body,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		&nrf.ImageOptions{Version: ver})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// uploadRecorder records the offsets of upload requests.
+type uploadRecorder struct {
+	*FakeServer
+	offsets []int
+}
+
+func (r *uploadRecorder) Send(b []byte) error {
+	var msg Message
+	if err := msg.UnmarshalBinary(b); err != nil {
+		return err
+	}
+	if msg.Group == GroupImage && msg.ID == IDImageUpload {
+		var req uploadReq
+		if err := cbor.Unmarshal(msg.Payload, &req); err != nil {
+			return err
+		}
+		r.offsets = append(r.offsets, req.Off)
+	}
+	return r.FakeServer.Send(b)
+}
+
+func imageHash(t *testing.T, img []byte) []byte {
+	t.Helper()
+	b, err := nrf.NewMCUBoot(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	area, err := b.ReadTLVArea()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return area.ImageHash
+}
+
+func TestClient(t *testing.T) {
+	server := NewFakeServer()
+	running := signTestImage(t, 0x400, nrf.ImgVersion{Major: 1})
+	if err := server.Install(0, running); err != nil {
+		t.Fatal(err)
+	}
+	rec := &uploadRecorder{FakeServer: server}
+	c := NewClient(rec)
+	c.MTU = 0x100
+
+	if s, err := c.Echo("hello"); err != nil || s != "hello" {
+		t.Fatalf("Echo = %q, %v", s, err)
+	}
+
+	update := signTestImage(t, 0x500, nrf.ImgVersion{Major: 1, Minor: 1, BuildNum: 7})
+	var progress []int
+	err := c.UploadBytes(update, 0, func(off, total int) {
+		if total != len(update) {
+			t.Errorf("progress total = %d, want %d", total, len(update))
+		}
+		progress = append(progress, off)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := c.MTU - uploadOverhead
+	if len(rec.offsets) != (len(update)+chunk-1)/chunk {
+		t.Fatalf("sent %d chunks of %d bytes for %d bytes", len(rec.offsets), chunk, len(update))
+	}
+	for i, off := range rec.offsets {
+		if off != i*chunk {
+			t.Errorf("chunk %d sent at offset %d, want %d", i, off, i*chunk)
+		}
+		if next := min((i+1)*chunk, len(update)); progress[i] != next {
+			t.Errorf("progress %d = %d, want %d", i, progress[i], next)
+		}
+	}
+
+	images, err := c.ImageList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 || images[1].Slot != 1 || images[1].Version != "1.1.0+7" {
+		t.Fatalf("images after upload = %+v", images)
+	}
+	hash := imageHash(t, update)
+	if !bytes.Equal(images[1].Hash, hash) {
+		t.Error("uploaded image hash differs")
+	}
+
+	images, err = c.Test(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !images[1].Pending || images[1].Permanent {
+		t.Errorf("tested image = %+v", images[1])
+	}
+	if err := c.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if server.Resets != 1 {
+		t.Errorf("Resets = %d, want 1", server.Resets)
+	}
+	images, err = c.ImageList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if images[0].Version != "1.1.0+7" || images[0].Confirmed {
+		t.Errorf("primary slot after the swap = %+v", images[0])
+	}
+	images, err = c.Confirm(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !images[0].Confirmed {
+		t.Error("running image is not confirmed")
+	}
+
+	if err := c.Erase(1); err != nil {
+		t.Fatal(err)
+	}
+	images, err = c.ImageList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 {
+		t.Errorf("%d images after erasing slot 1", len(images))
+	}
+
+	_, err = c.Test(make([]byte, 32))
+	var smpErr *Error
+	if !errors.As(err, &smpErr) || smpErr.Group != GroupImage || smpErr.RC != rcNoEnt {
+		t.Errorf("Test(unknown hash) = %v", err)
+	}
+}
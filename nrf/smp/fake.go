@@ -0,0 +1,285 @@
+package smp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/q0jt/go-nrf/nrf"
+)
+
+// mcumgr return codes
+const (
+	rcUnknown  = 1
+	rcInval    = 3
+	rcNoEnt    = 5
+	rcBadState = 6
+	rcNotSup   = 8
+)
+
+type fakeSlot struct {
+	data      []byte
+	hash      []byte
+	version   string
+	pending   bool
+	permanent bool
+	confirmed bool
+}
+
+type fakeUpload struct {
+	image int
+	sha   []byte
+	data  []byte
+	off   int
+}
+
+// FakeServer is an in-process SMP server that implements Transport. It
+// keeps a primary and a secondary slot per image and emulates MCUboot swaps
+// on reset, so clients can be tested without hardware.
+type FakeServer struct {
+	mu     sync.Mutex
+	slots  map[int]*[2]*fakeSlot
+	upload *fakeUpload
+	queue  [][]byte
+	// Resets counts the handled reset requests.
+	Resets int
+}
+
+func NewFakeServer() *FakeServer {
+	return &FakeServer{slots: map[int]*[2]*fakeSlot{}}
+}
+
+// Install places a confirmed image in the primary slot of image.
+func (s *FakeServer) Install(image int, b []byte) error {
+	slot, err := newFakeSlot(b)
+	if err != nil {
+		return err
+	}
+	slot.confirmed = true
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.image(image)[0] = slot
+	return nil
+}
+
+func newFakeSlot(b []byte) (*fakeSlot, error) {
+	boot, err := nrf.NewMCUBoot(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+	area, err := boot.ReadTLVArea()
+	if err != nil {
+		return nil, err
+	}
+	version := boot.Header().Ver.String()
+	return &fakeSlot{data: b, hash: area.ImageHash, version: version}, nil
+}
+
+func (s *FakeServer) image(n int) *[2]*fakeSlot {
+	slots, ok := s.slots[n]
+	if !ok {
+		slots = &[2]*fakeSlot{}
+		s.slots[n] = slots
+	}
+	return slots
+}
+
+// Send handles a request and queues its response.
+func (s *FakeServer) Send(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var req Message
+	if err := req.UnmarshalBinary(b); err != nil {
+		return err
+	}
+	res := s.handle(&req)
+	payload, err := cbor.Marshal(res)
+	if err != nil {
+		return err
+	}
+	rsp := &Message{Header: req.Header, Payload: payload}
+	rsp.Op = req.Op + 1
+	out, err := rsp.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	s.queue = append(s.queue, out)
+	return nil
+}
+
+// Recv returns the oldest queued response.
+func (s *FakeServer) Recv() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		return nil, errors.New("smp: no pending response")
+	}
+	b := s.queue[0]
+	s.queue = s.queue[1:]
+	return b, nil
+}
+
+func (s *FakeServer) Close() error {
+	return nil
+}
+
+func rc(code int) map[string]any {
+	return map[string]any{"rc": code}
+}
+
+func (s *FakeServer) handle(req *Message) map[string]any {
+	switch {
+	case req.Group == GroupOS && req.ID == IDOSEcho && req.Op == OpWrite:
+		var e echoReq
+		if err := cbor.Unmarshal(req.Payload, &e); err != nil {
+			return rc(rcInval)
+		}
+		return map[string]any{"r": e.D}
+	case req.Group == GroupOS && req.ID == IDOSReset && req.Op == OpWrite:
+		s.reset()
+		return map[string]any{}
+	case req.Group == GroupImage && req.ID == IDImageState && req.Op == OpRead:
+		return s.state()
+	case req.Group == GroupImage && req.ID == IDImageState && req.Op == OpWrite:
+		var st imageStateReq
+		if err := cbor.Unmarshal(req.Payload, &st); err != nil {
+			return rc(rcInval)
+		}
+		if code := s.setState(&st); code != 0 {
+			return rc(code)
+		}
+		return s.state()
+	case req.Group == GroupImage && req.ID == IDImageUpload && req.Op == OpWrite:
+		var up uploadReq
+		if err := cbor.Unmarshal(req.Payload, &up); err != nil {
+			return rc(rcInval)
+		}
+		return s.handleUpload(&up)
+	case req.Group == GroupImage && req.ID == IDImageErase && req.Op == OpWrite:
+		for _, slots := range s.slots {
+			if slots[1] != nil && slots[1].pending {
+				return rc(rcBadState)
+			}
+			slots[1] = nil
+		}
+		return map[string]any{}
+	}
+	return rc(rcNotSup)
+}
+
+func (s *FakeServer) state() map[string]any {
+	ids := make([]int, 0, len(s.slots))
+	for n := range s.slots {
+		ids = append(ids, n)
+	}
+	sort.Ints(ids)
+	var images []ImageState
+	for _, n := range ids {
+		slots := s.slots[n]
+		for i, slot := range slots {
+			if slot == nil {
+				continue
+			}
+			images = append(images, ImageState{
+				Image:     n,
+				Slot:      i,
+				Version:   slot.version,
+				Hash:      slot.hash,
+				Bootable:  true,
+				Pending:   slot.pending,
+				Confirmed: slot.confirmed,
+				Active:    i == 0,
+				Permanent: slot.permanent,
+			})
+		}
+	}
+	return map[string]any{"images": images}
+}
+
+func (s *FakeServer) setState(req *imageStateReq) int {
+	if req.Hash == nil {
+		if !req.Confirm {
+			return rcInval
+		}
+		for _, slots := range s.slots {
+			if slots[0] != nil {
+				slots[0].confirmed = true
+			}
+		}
+		return 0
+	}
+	for _, slots := range s.slots {
+		for i, slot := range slots {
+			if slot == nil || !bytes.Equal(slot.hash, req.Hash) {
+				continue
+			}
+			if i == 0 {
+				if req.Confirm {
+					slot.confirmed = true
+				}
+				return 0
+			}
+			slot.pending = true
+			slot.permanent = req.Confirm
+			return 0
+		}
+	}
+	return rcNoEnt
+}
+
+// reset swaps pending images into the primary slot, or reverts a tested
+// image that was not confirmed.
+func (s *FakeServer) reset() {
+	s.Resets++
+	for _, slots := range s.slots {
+		switch {
+		case slots[1] != nil && slots[1].pending:
+			next := slots[1]
+			next.pending = false
+			next.confirmed = next.permanent
+			next.permanent = false
+			slots[0], slots[1] = next, slots[0]
+		case slots[0] != nil && !slots[0].confirmed && slots[1] != nil:
+			slots[0], slots[1] = slots[1], slots[0]
+			slots[0].confirmed = true
+		}
+	}
+}
+
+func (s *FakeServer) handleUpload(req *uploadReq) map[string]any {
+	if req.Off == 0 {
+		if req.Len <= 0 {
+			return rc(rcInval)
+		}
+		s.upload = &fakeUpload{image: req.Image, sha: req.SHA, data: make([]byte, req.Len)}
+	}
+	up := s.upload
+	if up == nil {
+		return rc(rcInval)
+	}
+	if req.Off != up.off {
+		// Tell the client where to continue.
+		return map[string]any{"off": up.off}
+	}
+	if req.Off+len(req.Data) > len(up.data) {
+		return rc(rcInval)
+	}
+	copy(up.data[req.Off:], req.Data)
+	up.off += len(req.Data)
+	if up.off == len(up.data) {
+		s.upload = nil
+		sum := sha256.Sum256(up.data)
+		if up.sha != nil && !bytes.Equal(up.sha, sum[:]) {
+			return rc(rcInval)
+		}
+		slot, err := newFakeSlot(up.data)
+		if err != nil {
+			return rc(rcUnknown)
+		}
+		s.image(up.image)[1] = slot
+	}
+	return map[string]any{"off": up.off}
+}
@@ -0,0 +1,122 @@
+// Package smp implements a client for the Simple Management Protocol used by
+// mcumgr to manage images on MCUboot devices.
+package smp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+type Op uint8
+
+const (
+	OpRead     Op = 0
+	OpReadRsp  Op = 1
+	OpWrite    Op = 2
+	OpWriteRsp Op = 3
+)
+
+type Group uint16
+
+const (
+	GroupOS    Group = 0
+	GroupImage Group = 1
+)
+
+const (
+	IDOSEcho  uint8 = 0
+	IDOSReset uint8 = 5
+
+	IDImageState  uint8 = 0
+	IDImageUpload uint8 = 1
+	IDImageErase  uint8 = 5
+)
+
+const headerSize = 8
+
+// Header is the 8-byte SMP header. Multi-byte fields are big-endian.
+type Header struct {
+	Op    Op
+	Flags uint8
+	Len   uint16
+	Group Group
+	Seq   uint8
+	ID    uint8
+}
+
+// Message is a header followed by a CBOR payload.
+type Message struct {
+	Header
+	Payload []byte
+}
+
+func (m *Message) MarshalBinary() ([]byte, error) {
+	if len(m.Payload) > 0xFFFF {
+		return nil, errors.New("smp: payload is too large")
+	}
+	b := make([]byte, headerSize, headerSize+len(m.Payload))
+	b[0] = uint8(m.Op) & 0x07
+	b[1] = m.Flags
+	binary.BigEndian.PutUint16(b[2:], uint16(len(m.Payload)))
+	binary.BigEndian.PutUint16(b[4:], uint16(m.Group))
+	b[6] = m.Seq
+	b[7] = m.ID
+	return append(b, m.Payload...), nil
+}
+
+func (m *Message) UnmarshalBinary(b []byte) error {
+	if len(b) < headerSize {
+		return errors.New("smp: message is too short")
+	}
+	m.Op = Op(b[0] & 0x07)
+	m.Flags = b[1]
+	m.Len = binary.BigEndian.Uint16(b[2:])
+	m.Group = Group(binary.BigEndian.Uint16(b[4:]))
+	m.Seq = b[6]
+	m.ID = b[7]
+	if len(b)-headerSize != int(m.Len) {
+		return errors.New("smp: invalid payload length")
+	}
+	m.Payload = b[headerSize:]
+	return nil
+}
+
+func newMessage(op Op, group Group, id uint8, req any) (*Message, error) {
+	payload, err := cbor.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Header: Header{Op: op, Group: group, ID: id}, Payload: payload}, nil
+}
+
+// Error is a non-zero return code from the device.
+type Error struct {
+	Group Group
+	RC    int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("smp: group %d returned rc %d", e.Group, e.RC)
+}
+
+// rsp holds the return codes of SMP version 1 and 2 responses.
+type rsp struct {
+	RC  int `cbor:"rc,omitempty"`
+	Err *struct {
+		Group Group `cbor:"group"`
+		RC    int   `cbor:"rc"`
+	} `cbor:"err,omitempty"`
+}
+
+func (r *rsp) err(group Group) error {
+	if r.Err != nil && r.Err.RC != 0 {
+		return &Error{Group: r.Err.Group, RC: r.Err.RC}
+	}
+	if r.RC != 0 {
+		return &Error{Group: group, RC: r.RC}
+	}
+	return nil
+}
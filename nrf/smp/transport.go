@@ -0,0 +1,160 @@
+package smp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// Transport sends and receives complete SMP messages.
+type Transport interface {
+	Send(b []byte) error
+	Recv() ([]byte, error)
+	Close() error
+}
+
+const (
+	serialFrameStart = "\x06\x09"
+	serialFrameCont  = "\x04\x14"
+	// maximum line length including the frame marker and newline
+	serialFrameSize = 127
+)
+
+// SerialTransport frames messages for the mcumgr shell transport: a length
+// prefixed, CRC16 protected packet, base64 encoded and split into lines.
+type SerialTransport struct {
+	rw io.ReadWriteCloser
+	r  *bufio.Reader
+}
+
+// NewSerialTransport uses an already opened serial port.
+func NewSerialTransport(rw io.ReadWriteCloser) *SerialTransport {
+	return &SerialTransport{rw: rw, r: bufio.NewReader(rw)}
+}
+
+func (t *SerialTransport) Send(b []byte) error {
+	pkt := binary.BigEndian.AppendUint16(nil, uint16(len(b)+2))
+	pkt = append(pkt, b...)
+	pkt = binary.BigEndian.AppendUint16(pkt, crc16(b))
+	enc := base64.StdEncoding.EncodeToString(pkt)
+	var buf bytes.Buffer
+	for i := 0; len(enc) > 0; i++ {
+		marker := serialFrameCont
+		if i == 0 {
+			marker = serialFrameStart
+		}
+		n := min(len(enc), serialFrameSize-len(marker)-1)
+		buf.WriteString(marker)
+		buf.WriteString(enc[:n])
+		buf.WriteByte('\n')
+		enc = enc[n:]
+	}
+	_, err := t.rw.Write(buf.Bytes())
+	return err
+}
+
+func (t *SerialTransport) Recv() ([]byte, error) {
+	var enc []byte
+	for {
+		line, err := t.r.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case bytes.HasPrefix(line, []byte(serialFrameStart)):
+			enc = append(enc[:0], line[2:]...)
+		case bytes.HasPrefix(line, []byte(serialFrameCont)) && enc != nil:
+			enc = append(enc, line[2:]...)
+		default:
+			// console output between frames
+			continue
+		}
+		pkt := make([]byte, base64.StdEncoding.DecodedLen(len(enc)))
+		n, err := base64.StdEncoding.Decode(pkt, enc)
+		if err != nil || n < 2 {
+			continue
+		}
+		pkt = pkt[:n]
+		size := int(binary.BigEndian.Uint16(pkt))
+		if len(pkt)-2 < size {
+			continue
+		}
+		body := pkt[2 : 2+size]
+		if size < 2 {
+			return nil, errors.New("smp: invalid serial packet")
+		}
+		data, crc := body[:size-2], binary.BigEndian.Uint16(body[size-2:])
+		if crc16(data) != crc {
+			return nil, errors.New("smp: serial crc mismatch")
+		}
+		return data, nil
+	}
+}
+
+func (t *SerialTransport) Close() error {
+	return t.rw.Close()
+}
+
+// crc16 is CRC-16/XMODEM as used by the mcumgr serial framing.
+func crc16(b []byte) uint16 {
+	var crc uint16
+	for _, v := range b {
+		crc ^= uint16(v) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// DefaultUDPPort is the port of the Zephyr SMP UDP transport.
+const DefaultUDPPort = "1337"
+
+// UDPTransport sends one SMP message per datagram.
+type UDPTransport struct {
+	conn net.Conn
+	// Timeout bounds Recv when it is not zero.
+	Timeout time.Duration
+}
+
+// NewUDPTransport connects to addr, a host:port pair.
+func NewUDPTransport(addr string) (*UDPTransport, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPTransport{conn: conn}, nil
+}
+
+func (t *UDPTransport) Send(b []byte) error {
+	_, err := t.conn.Write(b)
+	return err
+}
+
+func (t *UDPTransport) Recv() ([]byte, error) {
+	if t.Timeout != 0 {
+		if err := t.conn.SetReadDeadline(time.Now().Add(t.Timeout)); err != nil {
+			return nil, err
+		}
+	}
+	b := make([]byte, 0x10000)
+	n, err := t.conn.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	return b[:n], nil
+}
+
+func (t *UDPTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,99 @@
+package smp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+type serialPort struct {
+	bytes.Buffer
+}
+
+func (p *serialPort) Close() error {
+	return nil
+}
+
+func TestCRC16(t *testing.T) {
+	// CRC-16/XMODEM check value
+	if got := crc16([]byte("123456789")); got != 0x31c3 {
+		t.Errorf("crc16 = %#04x, want 0x31c3", got)
+	}
+}
+
+func TestSerialTransport(t *testing.T) {
+	// An echo request with a payload long enough for three lines.
+	msg := &Message{
+		Header:  Header{Op: OpWrite, Group: GroupOS, Seq: 1, ID: IDOSEcho},
+		Payload: bytes.Repeat([]byte{'a'}, 200),
+	}
+	b, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := &serialPort{}
+	tr := NewSerialTransport(port)
+	if err := tr.Send(b); err != nil {
+		t.Fatal(err)
+	}
+	out := port.String()
+
+	lines := strings.SplitAfter(out, "\n")
+	lines = lines[:len(lines)-1]
+	if len(lines) != 3 {
+		t.Fatalf("message sent in %d lines, want 3", len(lines))
+	}
+	var enc string
+	for i, line := range lines {
+		marker := serialFrameCont
+		if i == 0 {
+			marker = serialFrameStart
+		}
+		if !strings.HasPrefix(line, marker) {
+			t.Errorf("line %d starts with %q", i, line[:2])
+		}
+		if len(line) > serialFrameSize {
+			t.Errorf("line %d is %d bytes long", i, len(line))
+		}
+		enc += strings.TrimSuffix(line[2:], "\n")
+	}
+	pkt, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.BigEndian.Uint16(pkt); int(size) != len(b)+2 || len(pkt) != len(b)+4 {
+		t.Fatalf("packet length %d for %d bytes", size, len(b))
+	}
+	if !bytes.Equal(pkt[2:2+len(b)], b) {
+		t.Error("packet data differs from the message")
+	}
+	if crc := binary.BigEndian.Uint16(pkt[2+len(b):]); crc != crc16(b) {
+		t.Errorf("packet crc = %#04x, want %#04x", crc, crc16(b))
+	}
+
+	// Console output between frames is skipped.
+	port.Reset()
+	port.WriteString("uart:~$ \r\n")
+	port.WriteString(strings.ReplaceAll(out, "\n", "\r\n"))
+	got, err := tr.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, b) {
+		t.Error("received message differs from the sent one")
+	}
+	if _, err := tr.Recv(); err != io.EOF {
+		t.Errorf("Recv after the last frame = %v", err)
+	}
+
+	port.Reset()
+	bad := bytes.Clone(pkt)
+	bad[len(bad)-1] ^= 1
+	port.WriteString(serialFrameStart + base64.StdEncoding.EncodeToString(bad) + "\n")
+	if _, err := tr.Recv(); err == nil {
+		t.Error("packet with a bad crc was accepted")
+	}
+}
@@ -0,0 +1,314 @@
+package nrf
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	softDeviceStart      = 0x1000
+	softDeviceInfoAddr   = 0x3000
+	softDeviceInfoMagic  = 0x51B1E5DB
+	softDeviceBlockSize  = 0x1000
+	softDeviceSigSize    = 0x2710
+	minBlockMatchPercent = 50
+)
+
+// SoftDeviceInfo is the info struct every SoftDevice stores at 0x3000.
+type SoftDeviceInfo struct {
+	InfoSize uint8
+	// End is the end address of the SoftDevice in flash.
+	End  uint32
+	FWID uint16
+	// ID is the SoftDevice number, e.g. 140, when the struct has it.
+	ID      uint32
+	Version uint32
+	Hash    []byte
+}
+
+// ReadSoftDeviceInfo reads the SoftDevice info struct.
+func ReadSoftDeviceInfo(r io.ReaderAt) (*SoftDeviceInfo, error) {
+	b := make([]byte, 0x2c)
+	n, err := r.ReadAt(b, softDeviceInfoAddr)
+	if n < 0x10 {
+		if err == nil || err == io.EOF {
+			err = errors.New("softdevice: info struct not found")
+		}
+		return nil, err
+	}
+	b = b[:n]
+	if binary.LittleEndian.Uint32(b[4:]) != softDeviceInfoMagic {
+		return nil, errors.New("softdevice: invalid info struct magic")
+	}
+	info := &SoftDeviceInfo{
+		InfoSize: b[0],
+		End:      binary.LittleEndian.Uint32(b[8:]),
+		FWID:     uint16(binary.LittleEndian.Uint32(b[0xc:])),
+	}
+	size := min(int(info.InfoSize), n)
+	if size >= 0x14 {
+		info.ID = binary.LittleEndian.Uint32(b[0x10:])
+	}
+	if size >= 0x18 {
+		info.Version = binary.LittleEndian.Uint32(b[0x14:])
+	}
+	if size >= 0x2c {
+		info.Hash = b[0x18:0x2c]
+	}
+	return info, nil
+}
+
+// VersionString formats Version, which is stored as MMMmmmppp.
+func (i *SoftDeviceInfo) VersionString() string {
+	if i.Version == 0 {
+		return ""
+	}
+	v := i.Version
+	return fmt.Sprintf("%d.%d.%d", v/1000000, v/1000%1000, v%1000)
+}
+
+type softDeviceRelease struct {
+	name    string
+	version string
+	// sdks are the nRF5 SDK releases bundling the SoftDevice, nil for
+	// standalone releases.
+	sdks []string
+}
+
+// softDeviceFWIDs are the --sd-req values listed by nrfutil.
+var softDeviceFWIDs = map[uint16]softDeviceRelease{
+	0x67:  {"S130", "1.0.0", []string{"10.0.0"}},
+	0x80:  {"S130", "2.0.0", []string{"11.0.0"}},
+	0x87:  {"S130", "2.0.1", []string{"12.0.0", "12.1.0", "12.2.0", "12.3.0"}},
+	0x81:  {"S132", "2.0.0", []string{"11.0.0"}},
+	0x88:  {"S132", "2.0.1", nil},
+	0x8C:  {"S132", "3.0.0", []string{"12.0.0"}},
+	0x91:  {"S132", "3.1.0", []string{"12.1.0", "12.2.0", "12.3.0"}},
+	0x95:  {"S132", "4.0.0", nil},
+	0x98:  {"S132", "4.0.2", []string{"13.0.0"}},
+	0x99:  {"S132", "4.0.3", nil},
+	0x9E:  {"S132", "4.0.4", nil},
+	0x9F:  {"S132", "4.0.5", nil},
+	0x9D:  {"S132", "5.0.0", []string{"14.0.0", "14.1.0"}},
+	0xA5:  {"S132", "5.1.0", []string{"14.2.0"}},
+	0xA7:  {"S112", "6.0.0", []string{"15.0.0"}},
+	0xA8:  {"S132", "6.0.0", []string{"15.0.0"}},
+	0xA9:  {"S140", "6.0.0", []string{"15.0.0"}},
+	0xB0:  {"S112", "6.1.0", []string{"15.1.0", "15.2.0"}},
+	0xAF:  {"S132", "6.1.0", []string{"15.1.0", "15.2.0"}},
+	0xAE:  {"S140", "6.1.0", []string{"15.1.0", "15.2.0"}},
+	0xB8:  {"S112", "6.1.1", []string{"15.3.0"}},
+	0xB7:  {"S132", "6.1.1", []string{"15.3.0"}},
+	0xB6:  {"S140", "6.1.1", []string{"15.3.0"}},
+	0xBC:  {"S212", "6.1.1", nil},
+	0xBA:  {"S332", "6.1.1", nil},
+	0xB9:  {"S340", "6.1.1", nil},
+	0xC4:  {"S112", "7.0.0", nil},
+	0xC3:  {"S113", "7.0.0", nil},
+	0xC2:  {"S132", "7.0.0", nil},
+	0xC1:  {"S140", "7.0.0", nil},
+	0xCD:  {"S112", "7.0.1", []string{"16.0.0"}},
+	0xCC:  {"S113", "7.0.1", []string{"16.0.0"}},
+	0xCB:  {"S132", "7.0.1", []string{"16.0.0"}},
+	0xCA:  {"S140", "7.0.1", []string{"16.0.0"}},
+	0x103: {"S112", "7.2.0", []string{"17.0.0", "17.0.2", "17.1.0"}},
+	0x102: {"S113", "7.2.0", []string{"17.0.0", "17.0.2", "17.1.0"}},
+	0x101: {"S132", "7.2.0", []string{"17.0.0", "17.0.2", "17.1.0"}},
+	0x100: {"S140", "7.2.0", []string{"17.0.0", "17.0.2", "17.1.0"}},
+	0x126: {"S112", "7.3.0", nil},
+	0x125: {"S113", "7.3.0", nil},
+	0x124: {"S132", "7.3.0", nil},
+	0x123: {"S140", "7.3.0", nil},
+}
+
+// Detection methods of a SoftDevice, strongest first.
+const (
+	DetectedByFWID   = "fwid"
+	DetectedByHash   = "hash"
+	DetectedByBlocks = "blocks"
+)
+
+// SoftDevice is the result of DetectSDKVersion.
+type SoftDevice struct {
+	Name    string
+	Version string
+	FWID    uint16
+	// SDKVersions are the nRF5 SDK releases that ship this SoftDevice.
+	SDKVersions []string
+	// Confidence is between 0 and 1.
+	Confidence float64
+	Method     string
+	Info       *SoftDeviceInfo
+}
+
+// DetectSDKVersion identifies the SoftDevice of a firmware image from the
+// info struct FWID and the hashes in the signature database. A hash over
+// the first 0x2710 bytes must match exactly, block hashes match partially
+// and lower the confidence accordingly.
+func DetectSDKVersion(r io.ReaderAt) (*SoftDevice, error) {
+	s, err := DefaultSignatures()
+	if err != nil {
+		return nil, err
+	}
+	return s.DetectSoftDevice(r)
+}
+
+// DetectSoftDevice is DetectSDKVersion with the given database, e.g. one
+// from LoadSignaturesWith.
+func (s *SDKSignatures) DetectSoftDevice(r io.ReaderAt) (*SoftDevice, error) {
+	var sd *SoftDevice
+	info, _ := ReadSoftDeviceInfo(r)
+	if info != nil {
+		sd = softDeviceFromInfo(info)
+	}
+	if m := s.matchSoftDevice(r, info); m != nil {
+		switch {
+		case sd == nil:
+			sd = m
+		case sd.Name == "" || sd.Name == m.Name:
+			if sd.Name == "" {
+				sd.Name = m.Name
+			}
+			if sd.Version == "" {
+				sd.Version = m.Version
+			}
+			sd.SDKVersions = mergeVersions(sd.SDKVersions, m.SDKVersions)
+			if m.Confidence > sd.Confidence {
+				sd.Confidence = m.Confidence
+				sd.Method = m.Method
+			}
+		}
+	}
+	if sd == nil || sd.Name == "" && sd.Version == "" {
+		return nil, errors.New("no SDK version detected")
+	}
+	return sd, nil
+}
+
+func softDeviceFromInfo(info *SoftDeviceInfo) *SoftDevice {
+	sd := &SoftDevice{
+		FWID:       info.FWID,
+		Version:    info.VersionString(),
+		Method:     DetectedByFWID,
+		Confidence: 0.5,
+		Info:       info,
+	}
+	if info.ID != 0 {
+		sd.Name = fmt.Sprintf("S%d", info.ID)
+	}
+	rel, ok := softDeviceFWIDs[info.FWID]
+	if !ok {
+		return sd
+	}
+	if (sd.Name == "" || sd.Name == rel.name) && (sd.Version == "" || sd.Version == rel.version) {
+		sd.Name = rel.name
+		sd.Version = rel.version
+		sd.SDKVersions = slices.Clone(rel.sdks)
+		sd.Confidence = 1
+	}
+	return sd
+}
+
+// matchSoftDevice returns the best database match for the image. Blocks
+// are hashed up to the end of the SoftDevice from info, and never past the
+// longest block list of the database.
+func (s *SDKSignatures) matchSoftDevice(r io.ReaderAt, info *SoftDeviceInfo) *SoftDevice {
+	var full string
+	if sig, err := generateSignature(r); err == nil {
+		full = hex.EncodeToString(sig)
+	}
+	var n int
+	for _, signature := range s.Signatures {
+		for _, hash := range signature.Hashes {
+			n = max(n, len(hash.Blocks))
+		}
+	}
+	end := uint32(softDeviceStart + n*softDeviceBlockSize)
+	if info != nil && info.End > softDeviceStart {
+		end = min(end, info.End)
+	}
+	blocks := softDeviceBlocks(r, end)
+	var best *SoftDevice
+	for _, signature := range s.Signatures {
+		for _, hash := range signature.Hashes {
+			var conf float64
+			method := DetectedByHash
+			if full != "" && full == hash.Signature {
+				conf = 1
+			} else if n := matchBlocks(blocks, hash.Blocks); n*100 >= len(hash.Blocks)*minBlockMatchPercent && n > 0 {
+				conf = float64(n) / float64(len(hash.Blocks))
+				method = DetectedByBlocks
+			} else {
+				continue
+			}
+			if best != nil && best.Name == hash.SoftDevice && best.Version == hash.Version && best.Confidence == conf {
+				best.SDKVersions = mergeVersions(best.SDKVersions, []string{signature.SdkVersion})
+				continue
+			}
+			if best == nil || conf > best.Confidence {
+				best = &SoftDevice{
+					Name:        hash.SoftDevice,
+					Version:     hash.Version,
+					FWID:        hash.FWID,
+					SDKVersions: []string{signature.SdkVersion},
+					Confidence:  conf,
+					Method:      method,
+				}
+			}
+		}
+	}
+	return best
+}
+
+// softDeviceBlocks returns the SHA256 of each full 4 KiB block from the
+// start of the SoftDevice up to end, or up to the end of r when end is 0.
+func softDeviceBlocks(r io.ReaderAt, end uint32) []string {
+	var blocks []string
+	b := make([]byte, softDeviceBlockSize)
+	for off := int64(softDeviceStart); end == 0 || off < int64(end); off += softDeviceBlockSize {
+		if _, err := r.ReadAt(b, off); err != nil {
+			break
+		}
+		blocks = append(blocks, hex.EncodeToString(sha256Sum(b)))
+	}
+	return blocks
+}
+
+func matchBlocks(blocks, known []string) int {
+	var n int
+	for i, h := range known {
+		if i < len(blocks) && blocks[i] == h {
+			n++
+		}
+	}
+	return n
+}
+
+func mergeVersions(a, b []string) []string {
+	out := slices.Clone(a)
+	for _, v := range b {
+		if !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (sd *SoftDevice) String() string {
+	s := fmt.Sprintf("%s %s (fwid 0x%04x, %s, %.0f%%)",
+		sd.Name, sd.Version, sd.FWID, sd.Method, sd.Confidence*100)
+	if len(sd.SDKVersions) != 0 {
+		s += " SDK " + strings.Join(sd.SDKVersions, ", ")
+	}
+	return s
+}
+
+// SoftDevice identifies the SoftDevice in the firmware.
+func (f *Firmware) SoftDevice() (*SoftDevice, error) {
+	return DetectSDKVersion(f.r)
+}
@@ -0,0 +1,147 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// readLimit records the end of the furthest read.
+type readLimit struct {
+	*bytes.Reader
+	end int64
+}
+
+func (r *readLimit) ReadAt(b []byte, off int64) (int, error) {
+	r.end = max(r.end, off+int64(len(b)))
+	return r.Reader.ReadAt(b, off)
+}
+
+func testSoftDevice(size int) []byte {
+	b := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+func setSoftDeviceInfo(b []byte, end uint32, fwid uint16, id, version uint32) {
+	info := b[softDeviceInfoAddr:]
+	info[0] = 0x2c
+	binary.LittleEndian.PutUint32(info[4:], softDeviceInfoMagic)
+	binary.LittleEndian.PutUint32(info[8:], end)
+	binary.LittleEndian.PutUint32(info[0xc:], 0xFFFF0000|uint32(fwid))
+	binary.LittleEndian.PutUint32(info[0x10:], id)
+	binary.LittleEndian.PutUint32(info[0x14:], version)
+}
+
+func blockHashes(b []byte, n int) []string {
+	var out []string
+	for i := 0; i < n; i++ {
+		off := softDeviceStart + i*softDeviceBlockSize
+		sum := sha256.Sum256(b[off : off+softDeviceBlockSize])
+		out = append(out, hex.EncodeToString(sum[:]))
+	}
+	return out
+}
+
+func TestDetectSoftDeviceFWID(t *testing.T) {
+	b := testSoftDevice(0x8000)
+	setSoftDeviceInfo(b, 0x27000, 0x0100, 140, 7002000)
+	sd, err := (&SDKSignatures{}).DetectSoftDevice(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.Name != "S140" || sd.Version != "7.2.0" || sd.Method != DetectedByFWID || sd.Confidence != 1 {
+		t.Errorf("detected %v", sd)
+	}
+	if !slices.Equal(sd.SDKVersions, []string{"17.0.0", "17.0.2", "17.1.0"}) {
+		t.Errorf("sdk versions = %v", sd.SDKVersions)
+	}
+
+	// An unknown FWID still reports the info struct.
+	setSoftDeviceInfo(b, 0x27000, 0x0fff, 140, 7004000)
+	sd, err = (&SDKSignatures{}).DetectSoftDevice(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.Name != "S140" || sd.Version != "7.4.0" || sd.Confidence != 0.5 {
+		t.Errorf("detected %v", sd)
+	}
+}
+
+func TestDetectSoftDeviceHash(t *testing.T) {
+	b := testSoftDevice(0x10000)
+	sum := sha256.Sum256(b[softDeviceStart : softDeviceStart+softDeviceSigSize])
+	db := &SDKSignatures{Signatures: []Signatures{
+		{SdkVersion: "15.3.0", Hashes: []Hash{{
+			SoftDevice: "S132",
+			Signature:  hex.EncodeToString(sum[:]),
+			Version:    "6.1.1",
+			FWID:       0xB7,
+			Blocks:     blockHashes(b, 4),
+		}}},
+	}}
+	r := &readLimit{Reader: bytes.NewReader(b)}
+	sd, err := db.DetectSoftDevice(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.Name != "S132" || sd.Version != "6.1.1" || sd.Method != DetectedByHash || sd.Confidence != 1 {
+		t.Errorf("detected %v", sd)
+	}
+	if !slices.Equal(sd.SDKVersions, []string{"15.3.0"}) {
+		t.Errorf("sdk versions = %v", sd.SDKVersions)
+	}
+	// Without an info struct, blocks past the longest list are not read.
+	if want := int64(softDeviceStart + 4*softDeviceBlockSize); r.end > want {
+		t.Errorf("read up to %#x, want at most %#x", r.end, want)
+	}
+}
+
+func TestDetectSoftDeviceBlocks(t *testing.T) {
+	b := testSoftDevice(0x10000)
+	db := &SDKSignatures{Signatures: []Signatures{
+		{SdkVersion: "17.1.0", Hashes: []Hash{{
+			SoftDevice: "S140",
+			Signature:  hex.EncodeToString(make([]byte, 32)),
+			Version:    "7.2.0",
+			FWID:       0x100,
+			Blocks:     blockHashes(b, 8),
+		}}},
+	}}
+	// A patched byte in the last block.
+	b[softDeviceStart+7*softDeviceBlockSize] ^= 1
+	sd, err := db.DetectSoftDevice(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.Name != "S140" || sd.Method != DetectedByBlocks || sd.Confidence != 7.0/8 {
+		t.Errorf("detected %v", sd)
+	}
+
+	// The info struct bounds the hashed blocks to the SoftDevice.
+	setSoftDeviceInfo(b, softDeviceStart+6*softDeviceBlockSize, 0x0fff, 0, 0)
+	db.Signatures[0].Hashes[0].Blocks = blockHashes(b, 8)
+	r := &readLimit{Reader: bytes.NewReader(b)}
+	sd, err = db.DetectSoftDevice(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.Method != DetectedByBlocks || sd.Confidence != 6.0/8 {
+		t.Errorf("detected %v", sd)
+	}
+	if want := int64(softDeviceStart + 6*softDeviceBlockSize); r.end > want {
+		t.Errorf("read up to %#x, want at most %#x", r.end, want)
+	}
+
+	// Fewer than half of the blocks is not a match.
+	for i := 0; i < 5; i++ {
+		b[softDeviceStart+i*softDeviceBlockSize+0x800] ^= 1
+	}
+	if _, err := db.DetectSoftDevice(bytes.NewReader(b)); err == nil {
+		t.Error("detected a SoftDevice from 1 of 8 blocks")
+	}
+}
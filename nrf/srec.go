@@ -0,0 +1,134 @@
+package nrf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const srecDataSize = 0x10
+
+func isSrecFile(b []byte) bool {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) > 1 && b[0] == 'S' && b[1] >= '0' && b[1] <= '9'
+}
+
+// SrecFileToBinary converts a Motorola S-record file to a binary starting at
+// address 0.
+func SrecFileToBinary(b []byte) ([]byte, error) {
+	img, err := ReadSrec(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	return img.Binary(), nil
+}
+
+// ReadSrec reads S1/S2/S3 data records and the S7/S8/S9 start address.
+func ReadSrec(r io.Reader) (*FlashImage, error) {
+	img := NewFlashImage()
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		s := strings.TrimSpace(sc.Text())
+		if s == "" {
+			continue
+		}
+		if err := img.parseSrecLine(s); err != nil {
+			return nil, fmt.Errorf("srec: line %d: %w", line, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func (f *FlashImage) parseSrecLine(s string) error {
+	if len(s) < 4 || s[0] != 'S' {
+		return errors.New("invalid record")
+	}
+	rec, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return err
+	}
+	if int(rec[0]) != len(rec)-1 {
+		return errors.New("invalid record length")
+	}
+	var sum byte
+	for _, v := range rec[:len(rec)-1] {
+		sum += v
+	}
+	if ^sum != rec[len(rec)-1] {
+		return errors.New("invalid checksum")
+	}
+	size := srecAddrSize(s[1])
+	if size == 0 {
+		return fmt.Errorf("unknown record type S%c", s[1])
+	}
+	body := rec[1 : len(rec)-1]
+	if len(body) < size {
+		return errors.New("invalid record length")
+	}
+	var addr uint32
+	for _, v := range body[:size] {
+		addr = addr<<8 | uint32(v)
+	}
+	switch s[1] {
+	case '1', '2', '3':
+		return f.AddBinary(addr, body[size:])
+	case '7', '8', '9':
+		f.mem.SetStartAddress(addr)
+	}
+	return nil
+}
+
+func srecAddrSize(t byte) int {
+	switch t {
+	case '0', '1', '5', '9':
+		return 2
+	case '2', '6', '8':
+		return 3
+	case '3', '7':
+		return 4
+	}
+	return 0
+}
+
+// WriteSrec writes the image as S3 data records followed by an S7 record.
+func (f *FlashImage) WriteSrec(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	writeSrecRecord(bw, '0', 0, []byte("go-nrf"))
+	var count int
+	for _, segment := range f.mem.GetDataSegments() {
+		for i := 0; i < len(segment.Data); i += srecDataSize {
+			end := min(i+srecDataSize, len(segment.Data))
+			writeSrecRecord(bw, '3', segment.Address+uint32(i), segment.Data[i:end])
+			count++
+		}
+	}
+	if count <= 0xFFFF {
+		writeSrecRecord(bw, '5', uint32(count), nil)
+	}
+	start, _ := f.mem.GetStartAddress()
+	writeSrecRecord(bw, '7', start, nil)
+	return bw.Flush()
+}
+
+func writeSrecRecord(w *bufio.Writer, t byte, addr uint32, data []byte) {
+	size := srecAddrSize(t)
+	rec := make([]byte, 0, size+len(data)+2)
+	rec = append(rec, byte(size+len(data)+1))
+	for i := size - 1; i >= 0; i-- {
+		rec = append(rec, byte(addr>>(8*i)))
+	}
+	rec = append(rec, data...)
+	var sum byte
+	for _, v := range rec {
+		sum += v
+	}
+	rec = append(rec, ^sum)
+	fmt.Fprintf(w, "S%c%s\n", t, strings.ToUpper(hex.EncodeToString(rec)))
+}
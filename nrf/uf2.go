@@ -0,0 +1,164 @@
+package nrf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// UF2 family IDs of nRF52 series devices.
+const (
+	UF2FamilyNRF52    uint32 = 0x1B57745F
+	UF2FamilyNRF52833 uint32 = 0x621E937A
+	UF2FamilyNRF52840 uint32 = 0xADA52840
+)
+
+const (
+	uf2MagicStart0      uint32 = 0x0A324655
+	uf2MagicStart1      uint32 = 0x9E5D5157
+	uf2MagicEnd         uint32 = 0x0AB16F30
+	uf2FlagNotMainFlash uint32 = 0x00000001
+	uf2FlagFamilyID     uint32 = 0x00002000
+	uf2BlockSize               = 0x200
+	uf2MaxPayloadSize          = 0x1dc
+	uf2PayloadSize             = 0x100
+)
+
+type uf2Block struct {
+	MagicStart0 uint32
+	MagicStart1 uint32
+	Flags       uint32
+	TargetAddr  uint32
+	PayloadSize uint32
+	BlockNo     uint32
+	NumBlocks   uint32
+	// file size or family ID
+	FamilyID uint32
+	Data     [uf2MaxPayloadSize]uint8
+	MagicEnd uint32
+}
+
+func isUF2File(b []byte) bool {
+	if len(b) < 8 {
+		return false
+	}
+	return binary.LittleEndian.Uint32(b) == uf2MagicStart0 &&
+		binary.LittleEndian.Uint32(b[4:]) == uf2MagicStart1
+}
+
+// UF2FileToBinary converts a UF2 file to a binary starting at address 0.
+func UF2FileToBinary(b []byte) ([]byte, error) {
+	img, err := ReadUF2(b, 0)
+	if err != nil {
+		return nil, err
+	}
+	return img.Binary(), nil
+}
+
+// ReadUF2 reads the main flash blocks of a UF2 file. If family is not zero,
+// blocks for other families are rejected.
+func ReadUF2(b []byte, family uint32) (*FlashImage, error) {
+	if len(b) == 0 || len(b)%uf2BlockSize != 0 {
+		return nil, errors.New("uf2: invalid file size")
+	}
+	img := NewFlashImage()
+	var numBlocks uint32
+	seen := make(map[uint32]bool)
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		var block uf2Block
+		if err := binary.Read(r, binary.LittleEndian, &block); err != nil {
+			return nil, err
+		}
+		if err := block.valid(); err != nil {
+			return nil, err
+		}
+		if numBlocks == 0 {
+			numBlocks = block.NumBlocks
+		}
+		if block.NumBlocks != numBlocks || seen[block.BlockNo] {
+			return nil, fmt.Errorf("uf2: invalid block number %d", block.BlockNo)
+		}
+		// Blocks not meant for main flash still count toward NumBlocks.
+		seen[block.BlockNo] = true
+		if block.Flags&uf2FlagNotMainFlash != 0 {
+			continue
+		}
+		if family != 0 && (block.Flags&uf2FlagFamilyID == 0 || block.FamilyID != family) {
+			return nil, fmt.Errorf("uf2: unexpected family id 0x%08x", block.FamilyID)
+		}
+		data := block.Data[:block.PayloadSize]
+		if err := img.AddBinary(block.TargetAddr, data); err != nil {
+			return nil, err
+		}
+	}
+	if uint32(len(seen)) != numBlocks {
+		return nil, errors.New("uf2: missing blocks")
+	}
+	return img, nil
+}
+
+func (b *uf2Block) valid() error {
+	if b.MagicStart0 != uf2MagicStart0 || b.MagicStart1 != uf2MagicStart1 || b.MagicEnd != uf2MagicEnd {
+		return errors.New("uf2: invalid block magic")
+	}
+	if b.PayloadSize == 0 || b.PayloadSize > uf2MaxPayloadSize {
+		return errors.New("uf2: invalid payload size")
+	}
+	if b.BlockNo >= b.NumBlocks {
+		return fmt.Errorf("uf2: invalid block number %d", b.BlockNo)
+	}
+	if b.TargetAddr%4 != 0 || uint64(b.TargetAddr)+uint64(b.PayloadSize) > 1<<32 {
+		return fmt.Errorf("uf2: invalid block address 0x%08x", b.TargetAddr)
+	}
+	return nil
+}
+
+// WriteUF2 writes the image as UF2 blocks of 256 bytes tagged with family.
+// Blocks are aligned to 256 bytes and their payload to 4 bytes; gaps inside
+// a block are filled with 0xFF.
+func (f *FlashImage) WriteUF2(w io.Writer, family uint32) error {
+	type window struct{ lo, hi uint32 }
+	var windows []window
+	for _, segment := range f.mem.GetDataSegments() {
+		addr := uint64(segment.Address)
+		end := addr + uint64(len(segment.Data))
+		for addr < end {
+			base := addr &^ (uf2PayloadSize - 1)
+			lo := addr &^ 3
+			hi := min((end+3)&^3, base+uf2PayloadSize)
+			if n := len(windows); n > 0 && uint64(windows[n-1].lo)&^(uf2PayloadSize-1) == base {
+				windows[n-1].hi = uint32(hi)
+			} else {
+				windows = append(windows, window{uint32(lo), uint32(hi)})
+			}
+			addr = min(end, base+uf2PayloadSize)
+		}
+	}
+	var blocks []uf2Block
+	for _, win := range windows {
+		block := uf2Block{
+			MagicStart0: uf2MagicStart0,
+			MagicStart1: uf2MagicStart1,
+			TargetAddr:  win.lo,
+			PayloadSize: win.hi - win.lo,
+			MagicEnd:    uf2MagicEnd,
+		}
+		if family != 0 {
+			block.Flags |= uf2FlagFamilyID
+			block.FamilyID = family
+		}
+		copy(block.Data[:], f.BinaryRange(win.lo, win.hi))
+		blocks = append(blocks, block)
+	}
+	for i := range blocks {
+		blocks[i].BlockNo = uint32(i)
+		blocks[i].NumBlocks = uint32(len(blocks))
+		if err := binary.Write(w, binary.LittleEndian, &blocks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
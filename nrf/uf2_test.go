@@ -0,0 +1,98 @@
+package nrf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestUF2RoundTrip(t *testing.T) {
+	f := NewFlashImage()
+	app := bytes.Repeat([]byte{0x12, 0x34, 0x56, 0x78}, 0x50)
+	if err := f.AddBinary(0x1000, app); err != nil {
+		t.Fatal(err)
+	}
+	// An unaligned segment, e.g. a patched byte in the settings page.
+	if err := f.AddBinary(0x7f003, []byte{0xaa, 0xbb, 0xcc}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := f.WriteUF2(&buf, UF2FamilyNRF52840); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	var blocks []uf2Block
+	for r := bytes.NewReader(b); r.Len() > 0; {
+		var block uf2Block
+		if err := binary.Read(r, binary.LittleEndian, &block); err != nil {
+			t.Fatal(err)
+		}
+		if block.TargetAddr%4 != 0 || block.PayloadSize%4 != 0 {
+			t.Errorf("block at 0x%x with %d bytes is not aligned", block.TargetAddr, block.PayloadSize)
+		}
+		blocks = append(blocks, block)
+	}
+
+	// Add a block for another memory, such as a bootloader info file.
+	extra := blocks[0]
+	extra.Flags = uf2FlagNotMainFlash
+	extra.TargetAddr = 0x1000
+	extra.Data = [uf2MaxPayloadSize]uint8{0xee}
+	blocks = append(blocks, extra)
+	buf.Reset()
+	for i := range blocks {
+		blocks[i].BlockNo = uint32(i)
+		blocks[i].NumBlocks = uint32(len(blocks))
+		binary.Write(&buf, binary.LittleEndian, &blocks[i])
+	}
+
+	img, err := ReadUF2(buf.Bytes(), UF2FamilyNRF52840)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.BinaryRange(0x1000, 0x1000+uint32(len(app))); !bytes.Equal(got, app) {
+		t.Error("application data differs after the round trip")
+	}
+	if got := img.BinaryRange(0x7f000, 0x7f008); !bytes.Equal(got, []byte{0xff, 0xff, 0xff, 0xaa, 0xbb, 0xcc, 0xff, 0xff}) {
+		t.Errorf("unaligned segment = %x", got)
+	}
+
+	if _, err := ReadUF2(buf.Bytes()[:len(buf.Bytes())-uf2BlockSize], 0); err == nil {
+		t.Error("a file with a missing block was accepted")
+	}
+	if _, err := ReadUF2(buf.Bytes(), UF2FamilyNRF52); err == nil {
+		t.Error("blocks of another family were accepted")
+	}
+}
+
+func TestSrecRoundTrip(t *testing.T) {
+	const fixture = "S00600004844521B\n" +
+		"S1130000285F245F2212226A000424290008237C2A\n" +
+		"S9030000FC\n"
+	img, err := ReadSrec(strings.NewReader(fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x28, 0x5f, 0x24, 0x5f, 0x22, 0x12, 0x22, 0x6a, 0x00, 0x04, 0x24, 0x29, 0x00, 0x08, 0x23, 0x7c}
+	if got := img.Binary(); !bytes.Equal(got, want) {
+		t.Fatalf("Binary() = %x, want %x", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := img.WriteSrec(&buf); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ReadSrec(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(back.Binary(), want) {
+		t.Error("data differs after the round trip")
+	}
+
+	if _, err := ReadSrec(strings.NewReader("S1130000285F245F2212226A000424290008237C2B\n")); err == nil {
+		t.Error("a record with a bad checksum was accepted")
+	}
+}
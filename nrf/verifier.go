@@ -0,0 +1,192 @@
+package nrf
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// SignatureAlgorithm identifies a signature scheme and its key size.
+type SignatureAlgorithm int
+
+const (
+	ECDSAP256SHA256 SignatureAlgorithm = iota + 1
+	ECDSAP384SHA384
+	Ed25519
+	RSAPSS2048
+	RSAPSS3072
+	// RSAPKCS1v15 accepts RSA keys of any size.
+	RSAPKCS1v15
+)
+
+var signatureAlgorithmNames = map[SignatureAlgorithm]string{
+	ECDSAP256SHA256: "ECDSA-P256-SHA256",
+	ECDSAP384SHA384: "ECDSA-P384-SHA384",
+	Ed25519:         "Ed25519",
+	RSAPSS2048:      "RSA-PSS-2048",
+	RSAPSS3072:      "RSA-PSS-3072",
+	RSAPKCS1v15:     "RSA-PKCS1v15",
+}
+
+func (a SignatureAlgorithm) String() string {
+	if s, ok := signatureAlgorithmNames[a]; ok {
+		return s
+	}
+	return fmt.Sprintf("SignatureAlgorithm(%d)", int(a))
+}
+
+// Verifier verifies signatures of one algorithm.
+type Verifier interface {
+	// Verify checks sig over msg. When h is zero msg is the signed message,
+	// otherwise it is a digest computed with h. ECDSA signatures may be raw
+	// r||s or ASN.1.
+	Verify(key any, h crypto.Hash, msg, sig []byte) error
+}
+
+// UnsupportedKeyError is returned when a key cannot be used with an
+// algorithm.
+type UnsupportedKeyError struct {
+	Algorithm SignatureAlgorithm
+	Key       any
+}
+
+func (e *UnsupportedKeyError) Error() string {
+	if pk, ok := e.Key.(*rsa.PublicKey); ok {
+		return fmt.Sprintf("unsupported key rsa%d for %v", pk.N.BitLen(), e.Algorithm)
+	}
+	if pk, ok := e.Key.(*ecdsa.PublicKey); ok {
+		return fmt.Sprintf("unsupported key ecdsa %s for %v", pk.Curve.Params().Name, e.Algorithm)
+	}
+	return fmt.Sprintf("unsupported key type %T for %v", e.Key, e.Algorithm)
+}
+
+var (
+	verifiersMu sync.RWMutex
+	verifiers   = map[SignatureAlgorithm]Verifier{
+		ECDSAP256SHA256: ecdsaVerifier{ECDSAP256SHA256, elliptic.P256(), crypto.SHA256},
+		ECDSAP384SHA384: ecdsaVerifier{ECDSAP384SHA384, elliptic.P384(), crypto.SHA384},
+		Ed25519:         ed25519Verifier{},
+		RSAPSS2048:      rsaPSSVerifier{RSAPSS2048, 2048},
+		RSAPSS3072:      rsaPSSVerifier{RSAPSS3072, 3072},
+		RSAPKCS1v15:     rsaPKCS1v15Verifier{},
+	}
+)
+
+// RegisterVerifier adds or replaces the verifier of an algorithm.
+func RegisterVerifier(alg SignatureAlgorithm, v Verifier) {
+	verifiersMu.Lock()
+	defer verifiersMu.Unlock()
+	verifiers[alg] = v
+}
+
+// LookupVerifier returns the verifier registered for alg.
+func LookupVerifier(alg SignatureAlgorithm) (Verifier, error) {
+	verifiersMu.RLock()
+	defer verifiersMu.RUnlock()
+	v, ok := verifiers[alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signature algorithm %v", alg)
+	}
+	return v, nil
+}
+
+// VerifyWith verifies sig with the verifier registered for alg.
+func VerifyWith(alg SignatureAlgorithm, key any, h crypto.Hash, msg, sig []byte) error {
+	v, err := LookupVerifier(alg)
+	if err != nil {
+		return err
+	}
+	return v.Verify(key, h, msg, sig)
+}
+
+// KeyAlgorithm returns the default algorithm of a key. RSA keys default to
+// PKCS#1 v1.5.
+func KeyAlgorithm(key any) (SignatureAlgorithm, error) {
+	switch pk := key.(type) {
+	case *ecdsa.PublicKey:
+		switch pk.Curve {
+		case elliptic.P256():
+			return ECDSAP256SHA256, nil
+		case elliptic.P384():
+			return ECDSAP384SHA384, nil
+		}
+	case ed25519.PublicKey:
+		return Ed25519, nil
+	case *rsa.PublicKey:
+		return RSAPKCS1v15, nil
+	}
+	return 0, &UnsupportedKeyError{Key: key}
+}
+
+func digestOf(h, def crypto.Hash, msg []byte) (crypto.Hash, []byte) {
+	if h != 0 {
+		return h, msg
+	}
+	w := def.New()
+	w.Write(msg)
+	return def, w.Sum(nil)
+}
+
+type ecdsaVerifier struct {
+	alg   SignatureAlgorithm
+	curve elliptic.Curve
+	hash  crypto.Hash
+}
+
+func (v ecdsaVerifier) Verify(key any, h crypto.Hash, msg, sig []byte) error {
+	pk, ok := key.(*ecdsa.PublicKey)
+	if !ok || pk.Curve != v.curve {
+		return &UnsupportedKeyError{v.alg, key}
+	}
+	_, d := digestOf(h, v.hash, msg)
+	size := (v.curve.Params().BitSize + 7) / 8
+	if len(sig) == 2*size {
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return validSignature(ecdsa.Verify(pk, d, r, s))
+	}
+	return validSignature(ecdsa.VerifyASN1(pk, d, sig))
+}
+
+// ed25519Verifier verifies msg as is, MCUboot passes the image digest as the
+// message.
+type ed25519Verifier struct{}
+
+func (ed25519Verifier) Verify(key any, _ crypto.Hash, msg, sig []byte) error {
+	pk, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return &UnsupportedKeyError{Ed25519, key}
+	}
+	return validSignature(ed25519.Verify(pk, msg, sig))
+}
+
+type rsaPSSVerifier struct {
+	alg  SignatureAlgorithm
+	bits int
+}
+
+func (v rsaPSSVerifier) Verify(key any, h crypto.Hash, msg, sig []byte) error {
+	pk, ok := key.(*rsa.PublicKey)
+	if !ok || pk.N.BitLen() != v.bits {
+		return &UnsupportedKeyError{v.alg, key}
+	}
+	h, d := digestOf(h, crypto.SHA256, msg)
+	opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+	return rsa.VerifyPSS(pk, h, d, sig, opts)
+}
+
+type rsaPKCS1v15Verifier struct{}
+
+func (rsaPKCS1v15Verifier) Verify(key any, h crypto.Hash, msg, sig []byte) error {
+	pk, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return &UnsupportedKeyError{RSAPKCS1v15, key}
+	}
+	h, d := digestOf(h, crypto.SHA256, msg)
+	return rsa.VerifyPKCS1v15(pk, h, d, sig)
+}
@@ -0,0 +1,127 @@
+package nrf
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestVerifyWith(t *testing.T) {
+	msg := []byte("init packet")
+	digest := sha256.Sum256(msg)
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, p256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := make([]byte, 64)
+	r.FillBytes(raw[:32])
+	s.FillBytes(raw[32:])
+	asn1, err := ecdsa.SignASN1(rand.Reader, p256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pss, err := rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		alg  SignatureAlgorithm
+		key  any
+		h    crypto.Hash
+		msg  []byte
+		sig  []byte
+	}{
+		{"ecdsa raw", ECDSAP256SHA256, &p256.PublicKey, 0, msg, raw},
+		{"ecdsa asn.1 digest", ECDSAP256SHA256, &p256.PublicKey, crypto.SHA256, digest[:], asn1},
+		{"ed25519", Ed25519, edPub, 0, msg, ed25519.Sign(edKey, msg)},
+		{"rsa-pss", RSAPSS2048, &rsaKey.PublicKey, 0, msg, pss},
+		{"rsa-pkcs1v15 digest", RSAPKCS1v15, &rsaKey.PublicKey, crypto.SHA256, digest[:], pkcs1},
+	} {
+		if err := VerifyWith(tt.alg, tt.key, tt.h, tt.msg, tt.sig); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		bad := append([]byte(nil), tt.sig...)
+		bad[len(bad)/2] ^= 1
+		if err := VerifyWith(tt.alg, tt.key, tt.h, tt.msg, bad); err == nil {
+			t.Errorf("%s: modified signature verified", tt.name)
+		}
+	}
+
+	var keyErr *UnsupportedKeyError
+	if err := VerifyWith(RSAPSS3072, &rsaKey.PublicKey, 0, msg, pss); !errors.As(err, &keyErr) {
+		t.Errorf("rsa-2048 key with RSA-PSS-3072: %v", err)
+	}
+	if err := VerifyWith(ECDSAP384SHA384, &p256.PublicKey, 0, msg, raw); !errors.As(err, &keyErr) {
+		t.Errorf("p-256 key with ECDSA-P384-SHA384: %v", err)
+	}
+	if _, err := LookupVerifier(SignatureAlgorithm(100)); err == nil {
+		t.Error("found a verifier for an unknown algorithm")
+	}
+
+	for _, tt := range []struct {
+		key  any
+		want SignatureAlgorithm
+	}{
+		{&p256.PublicKey, ECDSAP256SHA256},
+		{edPub, Ed25519},
+		{&rsaKey.PublicKey, RSAPKCS1v15},
+	} {
+		if alg, err := KeyAlgorithm(tt.key); err != nil || alg != tt.want {
+			t.Errorf("KeyAlgorithm(%T) = %v, %v, want %v", tt.key, alg, err, tt.want)
+		}
+	}
+}
+
+type rejectVerifier struct{}
+
+func (rejectVerifier) Verify(any, crypto.Hash, []byte, []byte) error {
+	return errors.New("rejected")
+}
+
+func TestRegisterVerifier(t *testing.T) {
+	orig, err := LookupVerifier(Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { RegisterVerifier(Ed25519, orig) })
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("message")
+	sig := ed25519.Sign(key, msg)
+	RegisterVerifier(Ed25519, rejectVerifier{})
+	if err := VerifyWith(Ed25519, pub, 0, msg, sig); err == nil || err.Error() != "rejected" {
+		t.Errorf("replaced verifier was not used: %v", err)
+	}
+	RegisterVerifier(Ed25519, orig)
+	if err := VerifyWith(Ed25519, pub, 0, msg, sig); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,55 +2,169 @@ package nrf
 
 import (
 	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
 	"errors"
+	"slices"
+	"sort"
 )
 
-var keys = map[string][]byte{
-	"rsa2048":        {0x30, 0x82, 0x01, 0x0a},
-	"rsa3072":        {0x30, 0x82, 0x01, 0x8a},
-	"ecdsaP256":      {0x30, 0x59, 0x30, 0x13},
-	"ecdsaP384":      {0x30, 0x76, 0x30, 0x10},
-	"ed25519/x25519": {0x30, 0x2a, 0x30, 0x05},
+type keySuite struct {
+	name  string
+	magic []byte
+	size  int
+	// modulus size of RSA keys
+	bits int
 }
 
+// DER prefixes of the keys embedded in bootloaders. RSA keys are PKCS#1,
+// the others SubjectPublicKeyInfo.
+var keySuites = []keySuite{
+	{"rsa2048", []byte{0x30, 0x82, 0x01, 0x0a}, 0x10e, 2048},
+	{"rsa3072", []byte{0x30, 0x82, 0x01, 0x8a}, 0x18e, 3072},
+	{"ecdsaP256", []byte{0x30, 0x59, 0x30, 0x13}, 0x5b, 0},
+	{"ecdsaP384", []byte{0x30, 0x76, 0x30, 0x10}, 0x78, 0},
+	{"ed25519/x25519", []byte{0x30, 0x2a, 0x30, 0x05}, 0x2c, 0},
+}
+
+// VerifyingKey is a public key found in a firmware image.
+type VerifyingKey struct {
+	Offset int
+	Suite  string
+	// Data is the key as stored in the image.
+	Data []byte
+	// Key is the parsed *rsa.PublicKey, *ecdsa.PublicKey,
+	// ed25519.PublicKey or *ecdh.PublicKey.
+	Key any
+	// Known is set by KeyRegistry.FindVerifyingKeys when the key is in the
+	// registry.
+	Known *KnownKey
+}
+
+// DumpVerifyingKey returns the first valid verifying key in b.
 func DumpVerifyingKey(b []byte) ([]byte, error) {
-	r := bytes.NewReader(b)
-	for suite, v := range keys {
-		offset := findVerifyingKey(b, v)
+	keys := FindVerifyingKeys(b)
+	if len(keys) == 0 {
+		return nil, errors.New("verifying key not found")
+	}
+	return keys[0].Data, nil
+}
+
+// FindVerifyingKeys returns every key in b that parses, sorted by offset.
+func FindVerifyingKeys(b []byte) []*VerifyingKey {
+	var keys []*VerifyingKey
+	for _, suite := range keySuites {
+		for _, offset := range findVerifyingKeys(b, suite.magic) {
+			if offset+suite.size > len(b) {
+				continue
+			}
+			der := b[offset : offset+suite.size]
+			key, name, ok := parseVerifyingKey(suite, der)
+			if !ok {
+				continue
+			}
+			keys = append(keys, &VerifyingKey{
+				Offset: offset,
+				Suite:  name,
+				Data:   append([]byte(nil), der...),
+				Key:    key,
+			})
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].Offset < keys[j].Offset
+	})
+	return keys
+}
+
+func parseVerifyingKey(suite keySuite, der []byte) (any, string, bool) {
+	if suite.bits != 0 {
+		key, err := loadRsaKey(der)
+		if err != nil || key.N.BitLen() != suite.bits {
+			return nil, "", false
+		}
+		return key, suite.name, true
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, "", false
+	}
+	switch key.(type) {
+	case ed25519.PublicKey:
+		return key, "ed25519", true
+	case *ecdh.PublicKey:
+		return key, "x25519", true
+	}
+	return key, suite.name, true
+}
+
+func findVerifyingKeys(b, magic []byte) []int {
+	var offsets []int
+	idx := 0
+	for {
+		offset := bytes.Index(b[idx:], magic)
 		if offset == -1 {
+			return offsets
+		}
+		offsets = append(offsets, idx+offset)
+		idx += offset + 1
+	}
+}
+
+const nrf5KeySize = 0x40
+
+// FindNRF5PublicKeys returns the raw P-256 keys in b stored as in the
+// nRF5 SDK dfu_public_key.c: X and Y, each 32 bytes little-endian.
+// The curve generator, found in crypto libraries in the same layout, is
+// skipped.
+func FindNRF5PublicKeys(b []byte) []*VerifyingKey {
+	var keys []*VerifyingKey
+	curve := elliptic.P256().Params()
+	for offset := 0; offset+nrf5KeySize <= len(b); offset++ {
+		raw := b[offset : offset+nrf5KeySize]
+		be := reverseP256Key(raw)
+		// NewPublicKey rejects points that are not on the curve.
+		if _, err := ecdh.P256().NewPublicKey(append([]byte{0x04}, be...)); err != nil {
 			continue
 		}
-		size := getVerifyingKeySize(suite)
-		key := make([]byte, size)
-		_, err := r.ReadAt(key, int64(offset))
+		key, err := setP256PublicKey(be)
 		if err != nil {
-			return nil, err
+			continue
+		}
+		if key.X.Cmp(curve.Gx) == 0 && key.Y.Cmp(curve.Gy) == 0 {
+			continue
 		}
-		return key, nil
+		keys = append(keys, &VerifyingKey{
+			Offset: offset,
+			Suite:  "nrf5P256",
+			Data:   append([]byte(nil), raw...),
+			Key:    key,
+		})
 	}
-	return nil, errors.New("verifying key not found")
+	return keys
 }
 
-func getVerifyingKeySize(suite string) int {
-	switch suite {
-	case "rsa2048":
-		return 0x10e
-	case "rsa3072":
-		return 0x18e
-	case "ecdsaP384":
-		return 0x78
-	case "ecdsaP256":
-		return 0x5b
-	case "ed25519/x25519":
-		return 0x2c
-	}
-	return 0
+// reverseP256Key converts between the little-endian and big-endian
+// encodings of a raw X||Y key.
+func reverseP256Key(b []byte) []byte {
+	out := append([]byte(nil), b...)
+	slices.Reverse(out[:0x20])
+	slices.Reverse(out[0x20:])
+	return out
 }
 
-func findVerifyingKey(b, magic []byte) int {
-	offset := bytes.Index(b, magic)
-	if offset == -1 {
-		return -1
+// DumpBootloaderKey returns the public key of the nRF5 secure bootloader as
+// big-endian X||Y, the form DfuInfo.Verify accepts.
+func (f *Firmware) DumpBootloaderKey() ([]byte, error) {
+	bl, err := f.ExtractBootloader()
+	if err != nil {
+		return nil, err
+	}
+	keys := FindNRF5PublicKeys(bl)
+	if len(keys) == 0 {
+		return nil, errors.New("bootloader public key not found")
 	}
-	return offset
+	return reverseP256Key(keys[0].Data), nil
 }
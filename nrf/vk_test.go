@@ -0,0 +1,77 @@
+package nrf
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+)
+
+func TestFindVerifyingKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaDER := x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)
+	ecDER, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edDER, err := x509.MarshalPKIXPublicKey(edPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := bytes.Repeat([]byte{0xff}, 0x800)
+	// A P-256 prefix followed by garbage is not a key.
+	copy(b[0x10:], []byte{0x30, 0x59, 0x30, 0x13, 0x00})
+	copy(b[0x600:], rsaDER)
+	copy(b[0x100:], ecDER)
+	copy(b[0x400:], edDER)
+
+	keys := FindVerifyingKeys(b)
+	want := []struct {
+		offset int
+		suite  string
+		der    []byte
+	}{
+		{0x100, "ecdsaP384", ecDER},
+		{0x400, "ed25519", edDER},
+		{0x600, "rsa2048", rsaDER},
+	}
+	if len(keys) != len(want) {
+		t.Fatalf("found %d keys, want %d", len(keys), len(want))
+	}
+	for i, w := range want {
+		k := keys[i]
+		if k.Offset != w.offset || k.Suite != w.suite || !bytes.Equal(k.Data, w.der) {
+			t.Errorf("key %d = %#x %s, want %#x %s", i, k.Offset, k.Suite, w.offset, w.suite)
+		}
+	}
+	if pk, ok := keys[2].Key.(*rsa.PublicKey); !ok || !pk.Equal(&rsaKey.PublicKey) {
+		t.Error("rsa key was not parsed")
+	}
+
+	first, err := DumpVerifyingKey(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, ecDER) {
+		t.Error("DumpVerifyingKey did not return the first key")
+	}
+	if _, err := DumpVerifyingKey(b[:0x100]); err == nil {
+		t.Error("found a key in data without keys")
+	}
+}